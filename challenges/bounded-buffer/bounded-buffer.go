@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"time"
+)
+
+// BoundedBuffer is a bounded buffer backed by a buffered channel, which means
+// its capacity is fixed. Use RingBuffer for a buffer that can be resized
+type BoundedBuffer[T any] struct {
+	items chan T
+
+	// slots holds a token for every item in the buffer. Producers take one
+	// before sending and consumers give it back once the item has left, so an
+	// item moved out of items by Peek still counts against the capacity
+	slots chan struct{}
+
+	// head is the item Peek pulled off items to look at, it is older than
+	// anything still in items so it is always taken first. Items are only ever
+	// taken from head or items with headMu held so the two stay in order
+	head    T
+	hasHead bool
+	headMu  *sync.Mutex
+
+	// ready wakes blocked consumers when there might be something to take,
+	// they can't wait on items directly since they need headMu to take from it
+	ready chan struct{}
+
+	// closing is closed as soon as Close is called so blocked producers give up,
+	// closed is closed once no producer can add to items anymore so consumers
+	// know that an empty buffer will stay empty
+	closing chan struct{}
+	closed  chan struct{}
+	once    *sync.Once
+	mu      *sync.RWMutex
+
+	opts     options[T]
+	watchers *watchers
+}
+
+func NewBoundedBuffer[T any](size int, opts ...Option[T]) *BoundedBuffer[T] {
+	return &BoundedBuffer[T]{
+		items:    make(chan T, size),
+		slots:    make(chan struct{}, size),
+		headMu:   &sync.Mutex{},
+		ready:    make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+		once:     &sync.Once{},
+		mu:       &sync.RWMutex{},
+		opts:     newOptions(opts),
+		watchers: newWatchers(),
+	}
+}
+
+func (b *BoundedBuffer[T]) Put(item T) error {
+	return b.PutContext(context.Background(), item)
+}
+
+func (b *BoundedBuffer[T]) Take() (T, error) {
+	return b.TakeContext(context.Background())
+}
+
+// PutContext adds item to the buffer. When the buffer is full what happens
+// depends on the overflow policy, by default it blocks until space is available
+// or ctx is done, in which case ctx.Err() is returned
+func (b *BoundedBuffer[T]) PutContext(ctx context.Context, item T) error {
+	var e events[T]
+
+	// registered before the unlock so it runs after it
+	defer b.opts.report(&e)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// select picks randomly between ready cases so make sure we never add
+	// to a buffer that has started closing even if there is space
+	select {
+	case <-b.closing:
+		return ErrClosed
+	default:
+	}
+
+	if cap(b.items) == 0 {
+		return b.handOff(ctx, item, &e)
+	}
+
+	if b.opts.overflow != Block {
+		return b.offer(item, &e)
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+		b.send(item, &e)
+		return nil
+	default:
+	}
+
+	start := time.Now()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-b.closing:
+		err = ErrClosed
+	case b.slots <- struct{}{}:
+		b.send(item, &e)
+	}
+
+	e.putBlocked = time.Since(start)
+
+	return err
+}
+
+// send adds item once a slot has been taken for it, which means there is
+// always room in items
+func (b *BoundedBuffer[T]) send(item T, e *events[T]) {
+	b.items <- item
+	e.put, e.depth = 1, b.Len()
+	b.signalReady()
+	b.watchers.notify()
+}
+
+// handOff gives item straight to a consumer, a zero size buffer has nowhere to
+// keep it so this is the only way an item gets through. If no consumer is
+// waiting the overflow policy applies as if the buffer was full
+func (b *BoundedBuffer[T]) handOff(ctx context.Context, item T, e *events[T]) error {
+	select {
+	case b.items <- item:
+		e.put = 1
+		return nil
+	default:
+	}
+
+	switch b.opts.overflow {
+	case DropNewest, DropOldest:
+		// nothing is ever held so the new item is the one that doesn't fit
+		e.dropped = append(e.dropped, item)
+		return nil
+	case Reject:
+		return ErrFull
+	}
+
+	start := time.Now()
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-b.closing:
+		err = ErrClosed
+	case b.items <- item:
+		e.put = 1
+	}
+
+	e.putBlocked = time.Since(start)
+
+	return err
+}
+
+// signalReady wakes a blocked consumer, if there is already a wake up pending
+// that one will do
+func (b *BoundedBuffer[T]) signalReady() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// offer adds item without blocking, making room according to the overflow
+// policy when the buffer is full
+func (b *BoundedBuffer[T]) offer(item T, e *events[T]) error {
+	for {
+		select {
+		case b.slots <- struct{}{}:
+			b.send(item, e)
+			return nil
+		default:
+		}
+
+		switch b.opts.overflow {
+		case DropNewest:
+			e.dropped = append(e.dropped, item)
+			return nil
+		case DropOldest:
+			oldest, _, ok := b.takeNow()
+			if ok {
+				e.dropped = append(e.dropped, oldest)
+			}
+
+			// otherwise a consumer beat us to it so there should be room now
+		default:
+			return ErrFull
+		}
+	}
+}
+
+// Peek returns the next item to be taken without removing it. ok is false if
+// the buffer is empty, which a zero size buffer always is
+func (b *BoundedBuffer[T]) Peek() (item T, ok bool) {
+	if cap(b.items) == 0 {
+		return item, false
+	}
+
+	b.headMu.Lock()
+	defer b.headMu.Unlock()
+
+	if b.hasHead {
+		return b.head, true
+	}
+
+	select {
+	case item := <-b.items:
+		b.head, b.hasHead = item, true
+		return item, true
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+// takeNow takes the next item if there is one without blocking, depth is how
+// many were left right after
+func (b *BoundedBuffer[T]) takeNow() (item T, depth int, ok bool) {
+	b.headMu.Lock()
+
+	if b.hasHead {
+		var zero T
+		item, b.head, b.hasHead = b.head, zero, false
+		ok = true
+	} else {
+		select {
+		case item = <-b.items:
+			ok = true
+		default:
+		}
+	}
+
+	b.headMu.Unlock()
+
+	if !ok {
+		return item, 0, false
+	}
+
+	return item, b.release(), true
+}
+
+// release gives back the slot of an item that has left the buffer and returns
+// how many items are left. The count is taken first so a producer waiting on
+// the slot doesn't show up in it. A handed off item never had a slot
+func (b *BoundedBuffer[T]) release() int {
+	if cap(b.items) == 0 {
+		return 0
+	}
+
+	depth := b.Len()
+	<-b.slots
+
+	return depth
+}
+
+// TakeContext removes an item from the buffer, blocking until one is available
+// or ctx is done, in which case ctx.Err() is returned. Once the buffer is closed
+// the remaining items are still handed out and ErrClosed is returned after that
+func (b *BoundedBuffer[T]) TakeContext(ctx context.Context) (T, error) {
+	var e events[T]
+	defer b.opts.report(&e)
+
+	item, depth, ok := b.takeNow()
+	if ok {
+		e.taken, e.depth = 1, depth
+		return item, nil
+	}
+
+	start := time.Now()
+
+	item, depth, err := b.take(ctx)
+
+	e.takeBlocked = time.Since(start)
+
+	if err == nil {
+		e.taken, e.depth = 1, depth
+	}
+
+	return item, err
+}
+
+func (b *BoundedBuffer[T]) take(ctx context.Context) (T, int, error) {
+	var zero T
+
+	// a zero size buffer only gets items by hand off so wait on items itself,
+	// nil otherwise so that case never fires
+	var handOff chan T
+	if cap(b.items) == 0 {
+		handOff = b.items
+	}
+
+	for {
+		item, depth, ok := b.takeNow()
+		if ok {
+			// we may have used up the only wake up so pass it on
+			if depth > 0 {
+				b.signalReady()
+			}
+
+			return item, depth, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, 0, ctx.Err()
+		case <-b.ready:
+			// someone else may get there first so check again
+		case item := <-handOff:
+			return item, 0, nil
+		case <-b.closed:
+			item, depth, ok := b.takeNow()
+			if ok {
+				return item, depth, nil
+			}
+
+			return zero, 0, ErrClosed
+		}
+	}
+}
+
+func (b *BoundedBuffer[T]) TryPut(item T, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := b.PutContext(ctx, item)
+	if errors.Is(err, context.DeadlineExceeded) {
+		b.opts.observer.PutTimeout()
+	}
+
+	return err
+}
+
+// TryTake removes an item from the buffer, waiting up to timeout for one to be
+// available. ok is false if the timeout expires or the buffer is closed and
+// drained, use TakeContext to tell the two apart
+func (b *BoundedBuffer[T]) TryTake(timeout time.Duration) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	item, err := b.TakeContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		b.opts.observer.TakeTimeout()
+	}
+
+	return item, err == nil
+}
+
+// PutAll adds items to the buffer in order, applying the overflow policy to
+// each item that doesn't fit, by default blocking until every item is added or
+// ctx is done. The number of items handled, including dropped ones, is always
+// returned, even on error
+func (b *BoundedBuffer[T]) PutAll(ctx context.Context, items []T) (int, error) {
+	for i, item := range items {
+		err := b.PutContext(ctx, item)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(items), nil
+}
+
+// TakeN blocks until at least one item is available and then takes up to max
+// items. If fewer than max items are available it waits up to linger for more
+// to arrive before returning what it has. An empty batch is returned if ctx is
+// done or the buffer is closed and drained before anything could be taken
+func (b *BoundedBuffer[T]) TakeN(ctx context.Context, max int, linger time.Duration) []T {
+	if max <= 0 {
+		return nil
+	}
+
+	item, err := b.TakeContext(ctx)
+	if err != nil {
+		return nil
+	}
+
+	batch := make([]T, 1, max)
+	batch[0] = item
+
+	// grab whatever is already there without waiting
+	drained := 0
+	depth := 0
+
+	for len(batch) < max {
+		item, d, ok := b.takeNow()
+		if !ok {
+			break
+		}
+
+		batch = append(batch, item)
+		drained++
+		depth = d
+	}
+
+	if drained > 0 {
+		b.opts.report(&events[T]{taken: drained, depth: depth})
+	}
+
+	if len(batch) == max || linger <= 0 {
+		return batch
+	}
+
+	lingerCtx, cancel := context.WithTimeout(ctx, linger)
+	defer cancel()
+
+	for len(batch) < max {
+		item, err := b.TakeContext(lingerCtx)
+		if err != nil {
+			break
+		}
+
+		batch = append(batch, item)
+	}
+
+	return batch
+}
+
+func (b *BoundedBuffer[T]) tryTake() (T, bool, error) {
+	var e events[T]
+	defer b.opts.report(&e)
+
+	var zero T
+
+	item, depth, ok := b.takeNow()
+	if ok {
+		e.taken, e.depth = 1, depth
+		return item, true, nil
+	}
+
+	select {
+	case <-b.closed:
+		// an item could have landed right before closing
+		item, depth, ok := b.takeNow()
+		if ok {
+			e.taken, e.depth = 1, depth
+			return item, true, nil
+		}
+
+		return zero, false, ErrClosed
+	default:
+		return zero, false, nil
+	}
+}
+
+func (b *BoundedBuffer[T]) watch(c chan<- struct{}) func() {
+	return b.watchers.add(c)
+}
+
+// Len returns how many items are in the buffer
+func (b *BoundedBuffer[T]) Len() int {
+	b.headMu.Lock()
+	defer b.headMu.Unlock()
+
+	n := len(b.items)
+	if b.hasHead {
+		n++
+	}
+
+	return n
+}
+
+// Cap returns how many items the buffer can hold
+func (b *BoundedBuffer[T]) Cap() int {
+	return cap(b.items)
+}
+
+// Dropped returns how many items have been discarded by the overflow policy
+func (b *BoundedBuffer[T]) Dropped() uint64 {
+	return b.opts.dropped.Load()
+}
+
+// Close stops the buffer from accepting new items. Items already in the buffer
+// can still be taken. Calling Close more than once is a no-op
+func (b *BoundedBuffer[T]) Close() {
+	b.once.Do(func() {
+		close(b.closing)
+
+		// wait for any in flight puts to either land or give up
+		b.mu.Lock()
+		close(b.closed)
+		b.mu.Unlock()
+
+		b.watchers.notify()
+	})
+}
+
+// All returns an iterator that takes items from the buffer until it is closed
+// and drained
+func (b *BoundedBuffer[T]) All() iter.Seq[T] {
+	return all(b.Take)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"testing/synctest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedBuffer_ZeroSizeHandOff(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		policy OverflowPolicy
+	}{
+		{desc: "block", policy: Block},
+		{desc: "drop newest", policy: DropNewest},
+		{desc: "drop oldest", policy: DropOldest},
+		{desc: "reject", policy: Reject},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := NewBoundedBuffer(0, WithOverflow[int](tc.policy))
+
+				var (
+					wg   sync.WaitGroup
+					item int
+					err  error
+				)
+
+				wg.Go(func() {
+					item, err = b.Take()
+				})
+
+				synctest.Wait()
+
+				// a waiting consumer means the item fits even with nowhere to hold it
+				assert.NoError(t, b.Put(1))
+
+				wg.Wait()
+
+				assert.NoError(t, err)
+				assert.Equal(t, 1, item)
+				assert.Zero(t, b.Dropped())
+			})
+		})
+	}
+}
+
+func TestBoundedBuffer_ZeroSizeBlockedPut(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewBoundedBuffer[int](0)
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			assert.NoError(t, b.Put(1))
+		})
+
+		synctest.Wait()
+
+		// the producer is still holding on to it
+		_, ok := b.Peek()
+		assert.False(t, ok)
+		assert.Equal(t, 0, b.Len())
+
+		item, err := b.Take()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, item)
+
+		wg.Wait()
+	})
+}
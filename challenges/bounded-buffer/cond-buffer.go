@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"time"
+)
+
+// condBuffer holds the blocking logic shared by the mutex/cond backed buffers.
+// The order items come out in is left to the queue. Producers wait on notFull
+// and consumers wait on notEmpty so each side only wakes up the other side
+type condBuffer[T any] struct {
+	queue queue[T]
+	size  int
+
+	closed   bool
+	opts     options[T]
+	watchers *watchers
+
+	mu       *sync.Mutex
+	notFull  *sync.Cond
+	notEmpty *sync.Cond
+}
+
+// queue stores the items of a condBuffer, it is only used with the lock held
+type queue[T any] interface {
+	push(item T)
+	// pop removes the next item to be taken
+	pop() T
+	// peek returns the next item to be taken without removing it
+	peek() T
+	// evict removes the item that would be taken last, used to make room
+	evict() T
+	len() int
+}
+
+func newCondBuffer[T any](q queue[T], size int, opts []Option[T]) *condBuffer[T] {
+	mu := &sync.Mutex{}
+
+	return &condBuffer[T]{
+		queue:    q,
+		size:     size,
+		opts:     newOptions(opts),
+		watchers: newWatchers(),
+		mu:       mu,
+		notFull:  sync.NewCond(mu),
+		notEmpty: sync.NewCond(mu),
+	}
+}
+
+func (b *condBuffer[T]) Put(item T) error {
+	return b.PutContext(context.Background(), item)
+}
+
+func (b *condBuffer[T]) Take() (T, error) {
+	return b.TakeContext(context.Background())
+}
+
+// PutContext adds item to the buffer. When the buffer is full what happens
+// depends on the overflow policy, by default it blocks until space is available
+// or ctx is done, in which case ctx.Err() is returned
+func (b *condBuffer[T]) PutContext(ctx context.Context, item T) error {
+	_, err := b.PutAll(ctx, []T{item})
+	return err
+}
+
+// TakeContext removes an item from the buffer, blocking until one is available
+// or ctx is done, in which case ctx.Err() is returned. Once the buffer is closed
+// the remaining items are still handed out and ErrClosed is returned after that
+func (b *condBuffer[T]) TakeContext(ctx context.Context) (T, error) {
+	var e events[T]
+
+	// registered before the unlock so it runs after it
+	defer b.opts.report(&e)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var zero T
+
+	for b.queue.len() == 0 && !b.closed {
+		err := timedWait(ctx, b.notEmpty, &e.takeBlocked)
+		if err != nil {
+			// we may have been the one woken up for the new item so pass it on
+			if b.queue.len() > 0 {
+				b.notEmpty.Signal()
+			}
+
+			return zero, err
+		}
+	}
+
+	if b.queue.len() == 0 {
+		return zero, ErrClosed
+	}
+
+	item := b.queue.pop()
+
+	b.notFull.Signal()
+
+	e.taken, e.depth = 1, b.queue.len()
+
+	return item, nil
+}
+
+// PutAll adds items to the buffer in order, moving as many as fit each time
+// the lock is held rather than one at a time. When the buffer is full the
+// overflow policy is applied to each item that doesn't fit, by default
+// blocking until every item is added or ctx is done. The number of items
+// handled, including dropped ones, is always returned, even on error
+func (b *condBuffer[T]) PutAll(ctx context.Context, items []T) (int, error) {
+	var e events[T]
+
+	// registered before the unlock so it runs after it
+	defer b.opts.report(&e)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := 0
+
+	for n < len(items) {
+		if b.closed {
+			return n, ErrClosed
+		}
+
+		// the buffer can be over size for a while after shrinking
+		if b.queue.len() >= b.size {
+			switch b.opts.overflow {
+			case DropNewest:
+				e.dropped = append(e.dropped, items[n])
+				n++
+				continue
+			case DropOldest:
+				if b.queue.len() == 0 {
+					// a zero size buffer has nothing to evict, so the new
+					// item is the one that doesn't fit
+					e.dropped = append(e.dropped, items[n])
+					n++
+					continue
+				}
+
+				e.dropped = append(e.dropped, b.queue.evict())
+				b.queue.push(items[n])
+				n++
+				e.put++
+				e.depth = b.queue.len()
+				b.watchers.notify()
+				continue
+			case Reject:
+				return n, ErrFull
+			default:
+				err := timedWait(ctx, b.notFull, &e.putBlocked)
+				if err != nil {
+					// we may have been the one woken up for the free slot so pass it on
+					if b.queue.len() < b.size {
+						b.notFull.Signal()
+					}
+
+					return n, err
+				}
+
+				continue
+			}
+		}
+
+		added := 0
+		for n < len(items) && b.queue.len() < b.size {
+			b.queue.push(items[n])
+			n++
+			added++
+		}
+
+		signal(b.notEmpty, added)
+		b.watchers.notify()
+
+		e.put += added
+		e.depth = b.queue.len()
+	}
+
+	return n, nil
+}
+
+// TakeN blocks until at least one item is available and then takes up to max
+// items. If fewer than max items are available it waits up to linger for more
+// to arrive before returning what it has. An empty batch is returned if ctx is
+// done or the buffer is closed and drained before anything could be taken
+func (b *condBuffer[T]) TakeN(ctx context.Context, max int, linger time.Duration) []T {
+	if max <= 0 {
+		return nil
+	}
+
+	var e events[T]
+
+	// registered before the unlock so it runs after it
+	defer b.opts.report(&e)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.queue.len() == 0 && !b.closed {
+		err := timedWait(ctx, b.notEmpty, &e.takeBlocked)
+		if err != nil {
+			if b.queue.len() > 0 {
+				b.notEmpty.Signal()
+			}
+
+			return nil
+		}
+	}
+
+	batch := make([]T, 0, min(max, b.queue.len()))
+	batch = b.popInto(batch, max)
+
+	if len(batch) == max || linger <= 0 {
+		e.taken, e.depth = len(batch), b.queue.len()
+		return batch
+	}
+
+	lingerCtx, cancel := context.WithTimeout(ctx, linger)
+	defer cancel()
+
+	for len(batch) < max && !b.closed {
+		err := timedWait(lingerCtx, b.notEmpty, &e.takeBlocked)
+
+		batch = b.popInto(batch, max)
+
+		if err != nil {
+			break
+		}
+	}
+
+	// anything left over belongs to someone else
+	if b.queue.len() > 0 {
+		b.notEmpty.Signal()
+	}
+
+	e.taken, e.depth = len(batch), b.queue.len()
+
+	return batch
+}
+
+func (b *condBuffer[T]) TryPut(item T, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := b.PutContext(ctx, item)
+	if errors.Is(err, context.DeadlineExceeded) {
+		b.opts.observer.PutTimeout()
+	}
+
+	return err
+}
+
+// TryTake removes an item from the buffer, waiting up to timeout for one to be
+// available. ok is false if the timeout expires or the buffer is closed and
+// drained, use TakeContext to tell the two apart
+func (b *condBuffer[T]) TryTake(timeout time.Duration) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	item, err := b.TakeContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		b.opts.observer.TakeTimeout()
+	}
+
+	return item, err == nil
+}
+
+// Peek returns the next item to be taken without removing it. ok is false if
+// the buffer is empty
+func (b *condBuffer[T]) Peek() (item T, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.queue.len() == 0 {
+		return item, false
+	}
+
+	return b.queue.peek(), true
+}
+
+// Len returns how many items are in the buffer, which can be more than Cap
+// right after the buffer has been shrunk
+func (b *condBuffer[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.queue.len()
+}
+
+// Cap returns how many items the buffer can hold
+func (b *condBuffer[T]) Cap() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// Resize changes the capacity of the buffer to n. Growing wakes up producers
+// waiting for the new space. Shrinking never discards items, the buffer just
+// stays over capacity and producers keep blocking until consumers drain it
+// below n. A size of 0 blocks all producers until the buffer is grown again
+func (b *condBuffer[T]) Resize(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size = max(n, 0)
+
+	signal(b.notFull, b.size-b.queue.len())
+}
+
+// Dropped returns how many items have been discarded by the overflow policy
+func (b *condBuffer[T]) Dropped() uint64 {
+	return b.opts.dropped.Load()
+}
+
+// Close stops the buffer from accepting new items. Items already in the buffer
+// can still be taken. Calling Close more than once is a no-op
+func (b *condBuffer[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	// everyone waiting needs to re-check now that we are closed
+	b.notFull.Broadcast()
+	b.notEmpty.Broadcast()
+	b.watchers.notify()
+}
+
+// All returns an iterator that takes items from the buffer until it is closed
+// and drained
+func (b *condBuffer[T]) All() iter.Seq[T] {
+	return all(b.Take)
+}
+
+func (b *condBuffer[T]) tryTake() (T, bool, error) {
+	var e events[T]
+
+	// registered before the unlock so it runs after it
+	defer b.opts.report(&e)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var zero T
+
+	if b.queue.len() == 0 {
+		if b.closed {
+			return zero, false, ErrClosed
+		}
+
+		return zero, false, nil
+	}
+
+	item := b.queue.pop()
+
+	b.notFull.Signal()
+
+	e.taken, e.depth = 1, b.queue.len()
+
+	return item, true, nil
+}
+
+func (b *condBuffer[T]) watch(c chan<- struct{}) func() {
+	return b.watchers.add(c)
+}
+
+// popInto moves items from the buffer onto batch until it holds max items or
+// the buffer is empty and wakes up a producer for every slot freed
+func (b *condBuffer[T]) popInto(batch []T, max int) []T {
+	taken := 0
+	for len(batch) < max && b.queue.len() > 0 {
+		batch = append(batch, b.queue.pop())
+		taken++
+	}
+
+	signal(b.notFull, taken)
+
+	return batch
+}
+
+// signal wakes up to n goroutines waiting on c
+func signal(c *sync.Cond, n int) {
+	for range n {
+		c.Signal()
+	}
+}
+
+// timedWait is waitContext that also adds how long it waited to blocked
+func timedWait(ctx context.Context, c *sync.Cond, blocked *time.Duration) error {
+	start := time.Now()
+
+	err := waitContext(ctx, c)
+
+	*blocked += time.Since(start)
+
+	return err
+}
+
+// waitContext is like c.Wait() but also wakes up when ctx is done. c.L must be
+// held by the caller, same as with c.Wait()
+func waitContext(ctx context.Context, c *sync.Cond) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	if ctx.Done() == nil {
+		// ctx can never be done so there is nothing to wake us up early
+		c.Wait()
+		return nil
+	}
+
+	// c.L is held until c.Wait() parks us so the broadcast can't be missed
+	stop := context.AfterFunc(ctx, func() {
+		c.L.Lock()
+		defer c.L.Unlock()
+
+		c.Broadcast()
+	})
+
+	c.Wait()
+	stop()
+
+	return ctx.Err()
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"sync"
+	"time"
+)
+
+// Codec turns items into bytes for the log and back again
+type Codec[T any] interface {
+	Encode(item T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec encodes items with encoding/json
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(item T) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+// DurableBuffer is a bounded buffer that survives restarts. Every put is
+// written to a log file before it is added to the buffer and every take is
+// acknowledged in the log once the item is handed out. Opening the same file
+// again puts everything that was never taken back in the buffer, in order
+type DurableBuffer[T any] struct {
+	items *RingBuffer[logged[T]]
+	codec Codec[T]
+
+	// turn is held by a put from logging its item until the item is in the
+	// buffer, so items go in in the same order they were logged and come back
+	// in that order on replay
+	turn chan struct{}
+
+	file    *os.File
+	nextSeq uint64
+	closed  bool
+	mu      *sync.Mutex
+}
+
+type logged[T any] struct {
+	seq  uint64
+	item T
+}
+
+// OpenDurableBuffer opens the log at path, creating it if it doesn't exist, and
+// replays any items that were put but never taken. If there are more of those
+// than size the buffer starts over capacity until consumers catch up
+func OpenDurableBuffer[T any](path string, size int, codec Codec[T]) (*DurableBuffer[T], error) {
+	pending, err := replay(path)
+	if err != nil {
+		return nil, fmt.Errorf("replaying log: %w", err)
+	}
+
+	items := make([]logged[T], 0, len(pending))
+	for i, data := range pending {
+		item, err := codec.Decode(data)
+		if err != nil {
+			return nil, fmt.Errorf("decoding item: %w", err)
+		}
+
+		items = append(items, logged[T]{seq: uint64(i), item: item})
+	}
+
+	// start the log over with just what is still pending so it doesn't grow
+	// forever across restarts
+	file, err := compact(path, pending)
+	if err != nil {
+		return nil, fmt.Errorf("compacting log: %w", err)
+	}
+
+	b := &DurableBuffer[T]{
+		items:   NewRingBuffer[logged[T]](max(size, len(items))),
+		codec:   codec,
+		turn:    make(chan struct{}, 1),
+		file:    file,
+		nextSeq: uint64(len(items)),
+		mu:      &sync.Mutex{},
+	}
+
+	b.items.PutAll(context.Background(), items)
+	b.items.Resize(size)
+
+	return b, nil
+}
+
+func (b *DurableBuffer[T]) Put(item T) error {
+	return b.PutContext(context.Background(), item)
+}
+
+func (b *DurableBuffer[T]) Take() (T, error) {
+	return b.TakeContext(context.Background())
+}
+
+// PutContext logs item and then adds it to the buffer, blocking until space is
+// available or ctx is done, in which case ctx.Err() is returned
+func (b *DurableBuffer[T]) PutContext(ctx context.Context, item T) error {
+	data, err := b.codec.Encode(item)
+	if err != nil {
+		return fmt.Errorf("encoding item: %w", err)
+	}
+
+	// it would be written fine but never make it back on replay
+	if len(data) > maxRecordData {
+		return fmt.Errorf("encoded item of %d bytes is over the limit of %d", len(data), maxRecordData)
+	}
+
+	// a channel rather than a mutex so waiting for our turn respects ctx
+	select {
+	case b.turn <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-b.turn }()
+
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+
+	seq := b.nextSeq
+	b.nextSeq++
+
+	err = b.write(putRecord, seq, data)
+
+	b.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("logging put: %w", err)
+	}
+
+	err = b.items.PutContext(ctx, logged[T]{seq: seq, item: item})
+	if errors.Is(err, ErrClosed) {
+		// closed after we logged it so it is safe and comes back on replay
+		return nil
+	}
+
+	if err != nil {
+		// never made it in so it must not come back on replay
+		b.ack(seq)
+		return err
+	}
+
+	return nil
+}
+
+// TakeContext removes an item from the buffer and acknowledges it in the log,
+// blocking until one is available or ctx is done, in which case ctx.Err() is
+// returned. If the acknowledgement can't be written the item is returned along
+// with the error and will be handed out again after a restart
+func (b *DurableBuffer[T]) TakeContext(ctx context.Context) (T, error) {
+	var zero T
+
+	l, err := b.items.TakeContext(ctx)
+	if err != nil {
+		return zero, err
+	}
+
+	err = b.ack(l.seq)
+	if errors.Is(err, ErrClosed) {
+		// still in the log so it isn't lost, it comes back on replay
+		return zero, ErrClosed
+	}
+
+	if err != nil {
+		return l.item, fmt.Errorf("logging take: %w", err)
+	}
+
+	return l.item, nil
+}
+
+func (b *DurableBuffer[T]) TryPut(item T, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return b.PutContext(ctx, item)
+}
+
+// TryTake removes an item from the buffer, waiting up to timeout for one to be
+// available. ok is false if the timeout expires, the buffer is closed or the
+// take couldn't be logged
+func (b *DurableBuffer[T]) TryTake(timeout time.Duration) (T, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	item, err := b.TakeContext(ctx)
+
+	return item, err == nil
+}
+
+// Len returns how many items are in the buffer
+func (b *DurableBuffer[T]) Len() int {
+	return b.items.Len()
+}
+
+// Cap returns how many items the buffer can hold
+func (b *DurableBuffer[T]) Cap() int {
+	return b.items.Cap()
+}
+
+// All returns an iterator that takes items from the buffer until it is closed
+func (b *DurableBuffer[T]) All() iter.Seq[T] {
+	return all(b.Take)
+}
+
+// Close stops both puts and takes and closes the log. Unlike the in memory
+// buffers the remaining items are not drained, they are already safe in the
+// log and will be replayed the next time it is opened
+func (b *DurableBuffer[T]) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+	b.items.Close()
+
+	return b.file.Close()
+}
+
+func (b *DurableBuffer[T]) ack(seq uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	return b.write(ackRecord, seq, nil)
+}
+
+// write appends a record to the log and syncs it, b.mu must be held
+func (b *DurableBuffer[T]) write(kind byte, seq uint64, data []byte) error {
+	_, err := b.file.Write(encodeRecord(kind, seq, data))
+	if err != nil {
+		return err
+	}
+
+	return b.file.Sync()
+}
+
+// records are laid out as
+//
+//	kind (1 byte) | seq (8 bytes) | len (4 bytes) | data (len bytes) | crc32 (4 bytes)
+//
+// with the crc covering everything before it so a record that was only
+// partially written when the process died can be detected and ignored
+const (
+	putRecord byte = 1
+	ackRecord byte = 2
+
+	recordHeaderSize = 1 + 8 + 4
+	recordCRCSize    = 4
+
+	// maxRecordData caps how much data a record can hold. The length is read
+	// before the crc can be checked so a corrupt one must not be trusted with
+	// an allocation
+	maxRecordData = 16 << 20
+)
+
+func encodeRecord(kind byte, seq uint64, data []byte) []byte {
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(data)+recordCRCSize)
+
+	buf[0] = kind
+	binary.BigEndian.PutUint64(buf[1:9], seq)
+	binary.BigEndian.PutUint32(buf[9:13], uint32(len(data)))
+
+	buf = append(buf, data...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	return buf
+}
+
+// replay reads the log at path and returns the data of every put that was
+// never acknowledged, in the order they were logged
+func replay(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var seqs []uint64
+	puts := make(map[uint64][]byte)
+	acked := make(map[uint64]bool)
+
+	for {
+		kind, seq, data, err := readRecord(r)
+		if err != nil {
+			// either the end of the log or a torn write at the end of it,
+			// both mean there is nothing more to trust
+			break
+		}
+
+		switch kind {
+		case putRecord:
+			seqs = append(seqs, seq)
+			puts[seq] = data
+		case ackRecord:
+			acked[seq] = true
+		}
+	}
+
+	pending := make([][]byte, 0, len(seqs))
+	for _, seq := range seqs {
+		if !acked[seq] {
+			pending = append(pending, puts[seq])
+		}
+	}
+
+	return pending, nil
+}
+
+func readRecord(r io.Reader) (byte, uint64, []byte, error) {
+	header := make([]byte, recordHeaderSize)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[9:13]))
+	if size > maxRecordData {
+		return 0, 0, nil, fmt.Errorf("record of %d bytes is over the limit of %d", size, maxRecordData)
+	}
+
+	rest := make([]byte, size+recordCRCSize)
+
+	_, err = io.ReadFull(r, rest)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	data := rest[:len(rest)-recordCRCSize]
+
+	crc := crc32.NewIEEE()
+	crc.Write(header)
+	crc.Write(data)
+
+	if crc.Sum32() != binary.BigEndian.Uint32(rest[len(rest)-recordCRCSize:]) {
+		return 0, 0, nil, errors.New("corrupt record")
+	}
+
+	return header[0], binary.BigEndian.Uint64(header[1:9]), data, nil
+}
+
+// compact replaces the log at path with one holding only pending, numbered
+// from 0, and returns it opened for appending
+func compact(path string, pending [][]byte) (*os.File, error) {
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	for i, data := range pending {
+		_, err = w.Write(encodeRecord(putRecord, uint64(i), data))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDurableBuffer_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 10, JSONCodec[string]{})
+	require.NoError(t, err)
+
+	for _, item := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, b.Put(item))
+	}
+
+	item, err := b.Take()
+	require.NoError(t, err)
+	assert.Equal(t, "a", item)
+
+	require.NoError(t, b.Close())
+
+	// everything that wasn't taken comes back
+	b, err = OpenDurableBuffer(path, 10, JSONCodec[string]{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, b.Len())
+
+	item, err = b.Take()
+	require.NoError(t, err)
+	assert.Equal(t, "b", item)
+
+	require.NoError(t, b.Put("e"))
+	require.NoError(t, b.Close())
+
+	b, err = OpenDurableBuffer(path, 10, JSONCodec[string]{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	var actual []string
+	for range b.Len() {
+		item, err := b.Take()
+		require.NoError(t, err)
+
+		actual = append(actual, item)
+	}
+
+	assert.Equal(t, []string{"c", "d", "e"}, actual)
+}
+
+func TestDurableBuffer_LogMatchesLiveOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 4, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+
+	// producers racing each other and blocking on a full buffer
+	for p := range 8 {
+		wg.Go(func() {
+			for i := range 50 {
+				b.Put(p*100 + i)
+			}
+		})
+	}
+
+	var live []int
+	for range 8 * 50 {
+		item, err := b.Take()
+		require.NoError(t, err)
+
+		live = append(live, item)
+	}
+
+	wg.Wait()
+	require.NoError(t, b.Close())
+
+	// replay hands items out in the order their puts were logged, so that has
+	// to be the order they came out live
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var logged []int
+	for {
+		kind, _, data, err := readRecord(r)
+		if err != nil {
+			break
+		}
+
+		if kind == putRecord {
+			item, err := JSONCodec[int]{}.Decode(data)
+			require.NoError(t, err)
+
+			logged = append(logged, item)
+		}
+	}
+
+	assert.Equal(t, live, logged)
+}
+
+func TestDurableBuffer_ReplayOverCapacity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 5, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	for i := range 5 {
+		require.NoError(t, b.Put(i))
+	}
+
+	require.NoError(t, b.Close())
+
+	// shrinking doesn't lose anything, it just blocks puts until drained
+	b, err = OpenDurableBuffer(path, 2, JSONCodec[int]{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Equal(t, 5, b.Len())
+	assert.Equal(t, 2, b.Cap())
+	assert.Error(t, b.TryPut(5, 10*time.Millisecond))
+}
+
+func TestDurableBuffer_FailedPutNotReplayed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 1, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put(1))
+	assert.Error(t, b.TryPut(2, 10*time.Millisecond))
+
+	require.NoError(t, b.Close())
+
+	b, err = OpenDurableBuffer(path, 1, JSONCodec[int]{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	assert.Equal(t, 1, b.Len())
+}
+
+func TestDurableBuffer_TornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 10, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put(1))
+	require.NoError(t, b.Put(2))
+	require.NoError(t, b.Close())
+
+	// simulate dying halfway through writing the last record
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-3))
+
+	b, err = OpenDurableBuffer(path, 10, JSONCodec[int]{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	item, ok := b.TryTake(0)
+	assert.True(t, ok)
+	assert.Equal(t, 1, item)
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestDurableBuffer_CorruptLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 10, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put(1))
+	require.NoError(t, b.Close())
+
+	// a header claiming far more data than there is, close enough to the max
+	// uint32 that adding the crc size would wrap
+	header := make([]byte, recordHeaderSize)
+	header[0] = putRecord
+	binary.BigEndian.PutUint32(header[9:13], 0xfffffffe)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.Write(append(header, 0, 0))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b, err = OpenDurableBuffer(path, 10, JSONCodec[int]{})
+	require.NoError(t, err)
+	defer b.Close()
+
+	// everything before the corrupt record is still replayed
+	item, ok := b.TryTake(0)
+	assert.True(t, ok)
+	assert.Equal(t, 1, item)
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestDurableBuffer_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buffer.log")
+
+	b, err := OpenDurableBuffer(path, 10, JSONCodec[int]{})
+	require.NoError(t, err)
+
+	require.NoError(t, b.Put(1))
+	require.NoError(t, b.Close())
+
+	assert.ErrorIs(t, b.Put(2), ErrClosed)
+
+	// not drained, the item stays in the log instead
+	_, err = b.Take()
+	assert.ErrorIs(t, err, ErrClosed)
+}
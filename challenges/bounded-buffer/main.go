@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"iter"
 	"log/slog"
 	"os"
 	"time"
@@ -20,16 +23,26 @@ func main() {
 }
 
 func run() error {
-	b := NewBoundedBuffer[int](2)
+	var b buffer[int]
+
+	switch impl := arg(1, "channel"); impl {
+	case "channel":
+		b = NewBoundedBuffer[int](2)
+	case "ring":
+		b = NewRingBuffer[int](2)
+	default:
+		return fmt.Errorf("unknown buffer '%s'", impl)
+	}
 
 	b.Put(1)
 	b.Put(2)
-	println(b.Take()) // 1
+	item, _ := b.Take()
+	println(item) // 1
 
 	b.Put(3)
 
-	ok := b.TryPut(4, 1*time.Second)
-	println(ok) // false
+	err := b.TryPut(4, 1*time.Second)
+	println(err != nil) // true
 
 	go func() {
 		time.AfterFunc(500*time.Millisecond, func() {
@@ -37,50 +50,78 @@ func run() error {
 		})
 	}()
 
-	ok = b.TryPut(4, 1*time.Second)
-	println(ok) // true
+	err = b.TryPut(4, 1*time.Second)
+	println(err == nil) // true
 
-	return nil
-}
+	b.Close()
 
-type BoundedBuffer[T any] struct {
-	items chan T
-}
+	err = b.Put(5)
+	println(errors.Is(err, ErrClosed)) // true
 
-func NewBoundedBuffer[T any](size int) BoundedBuffer[T] {
-	return BoundedBuffer[T]{
-		items: make(chan T, size),
+	for item := range b.All() {
+		println(item) // 3, 4
 	}
-}
 
-func (b *BoundedBuffer[T]) Put(item T) {
-	b.items <- item
+	return nil
 }
 
-func (b *BoundedBuffer[T]) Take() T {
-	return <-b.items
-}
+func arg(i int, fallback string) string {
+	if len(os.Args) <= i {
+		return fallback
+	}
 
-func (b *BoundedBuffer[T]) TryPut(item T, timeout time.Duration) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	return os.Args[i]
+}
 
-	select {
-	case <-ctx.Done():
-		return false
-	case b.items <- item:
-		return true
-	}
+// buffer is implemented by the channel backed BoundedBuffer as well as the
+// mutex/cond backed RingBuffer and PriorityBuffer so they can be swapped and
+// benchmarked
+type buffer[T any] interface {
+	Put(item T) error
+	Take() (T, error)
+	PutContext(ctx context.Context, item T) error
+	TakeContext(ctx context.Context) (T, error)
+	TryPut(item T, timeout time.Duration) error
+	TryTake(timeout time.Duration) (T, bool)
+	PutAll(ctx context.Context, items []T) (int, error)
+	TakeN(ctx context.Context, max int, linger time.Duration) []T
+	Peek() (T, bool)
+	Len() int
+	Cap() int
+	Dropped() uint64
+
+	// used by SelectTake
+
+	// tryTake takes an item if one is ready without blocking, err is
+	// ErrClosed once the buffer is closed and drained
+	tryTake() (item T, ok bool, err error)
+	// watch has c notified whenever there might be something to take
+	watch(c chan<- struct{}) (unwatch func())
+	Close()
+	All() iter.Seq[T]
 }
 
-func (b *BoundedBuffer[T]) TryTake(timeout time.Duration) *T {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+var (
+	_ buffer[int] = &BoundedBuffer[int]{}
+	_ buffer[int] = &RingBuffer[int]{}
+	_ buffer[int] = &PriorityBuffer[int]{}
+)
 
-	select {
-	case <-ctx.Done():
-		return nil
-	case item := <-b.items:
-		return &item
+// ErrClosed is returned when putting to a closed buffer or when taking from a
+// closed buffer that has been drained
+var ErrClosed = errors.New("buffer closed")
+
+func all[T any](take func() (T, error)) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for {
+			item, err := take()
+			if err != nil {
+				return
+			}
+
+			if !yield(item) {
+				return
+			}
+		}
 	}
 }
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var implementations = []struct {
+	name string
+	new  func(size int, opts ...Option[int]) buffer[int]
+}{
+	{
+		name: "channel",
+		new:  func(size int, opts ...Option[int]) buffer[int] { return NewBoundedBuffer(size, opts...) },
+	},
+	{
+		name: "ring",
+		new:  func(size int, opts ...Option[int]) buffer[int] { return NewRingBuffer(size, opts...) },
+	},
+}
+
+func TestBuffer_PutContext(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(1)
+
+				err := b.PutContext(t.Context(), 1)
+				assert.NoError(t, err)
+
+				ctx, cancel := context.WithTimeout(t.Context(), 1*time.Second)
+				defer cancel()
+
+				err = b.PutContext(ctx, 2)
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+				ctx, cancel = context.WithCancel(t.Context())
+				cancel()
+
+				err = b.PutContext(ctx, 2)
+				assert.ErrorIs(t, err, context.Canceled)
+			})
+		})
+	}
+}
+
+func TestBuffer_TakeContext(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(1)
+
+				ctx, cancel := context.WithTimeout(t.Context(), 1*time.Second)
+				defer cancel()
+
+				_, err := b.TakeContext(ctx)
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+				go func() {
+					time.Sleep(500 * time.Millisecond)
+					b.Put(1)
+				}()
+
+				item, err := b.TakeContext(t.Context())
+				assert.NoError(t, err)
+				assert.Equal(t, 1, item)
+			})
+		})
+	}
+}
+
+func TestBuffer_FIFO(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(3)
+
+				go func() {
+					defer b.Close()
+
+					for i := range 100 {
+						b.Put(i)
+					}
+				}()
+
+				expected := make([]int, 100)
+				for i := range expected {
+					expected[i] = i
+				}
+
+				actual := make([]int, 0, 100)
+				for item := range b.All() {
+					actual = append(actual, item)
+				}
+
+				assert.Equal(t, expected, actual)
+			})
+		})
+	}
+}
+
+func TestBuffer_Close(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(2)
+
+				assert.NoError(t, b.Put(1))
+				assert.NoError(t, b.Put(2))
+
+				// blocked producer is released by close
+				errs := make(chan error)
+				go func() {
+					errs <- b.Put(3)
+				}()
+
+				synctest.Wait()
+				b.Close()
+
+				assert.ErrorIs(t, <-errs, ErrClosed)
+				assert.ErrorIs(t, b.Put(4), ErrClosed)
+				assert.ErrorIs(t, b.TryPut(4, 1*time.Second), ErrClosed)
+
+				// remaining items are drained before reporting closed
+				item, err := b.Take()
+				assert.NoError(t, err)
+				assert.Equal(t, 1, item)
+
+				item, ok := b.TryTake(1 * time.Second)
+				assert.True(t, ok)
+				assert.Equal(t, 2, item)
+
+				_, err = b.Take()
+				assert.ErrorIs(t, err, ErrClosed)
+
+				_, ok = b.TryTake(1 * time.Second)
+				assert.False(t, ok)
+
+				// closing twice is fine
+				b.Close()
+			})
+		})
+	}
+}
+
+func TestBuffer_CloseWakesConsumers(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(2)
+
+				errs := make(chan error)
+				for range 3 {
+					go func() {
+						_, err := b.Take()
+						errs <- err
+					}()
+				}
+
+				synctest.Wait()
+				b.Close()
+
+				for range 3 {
+					assert.ErrorIs(t, <-errs, ErrClosed)
+				}
+			})
+		})
+	}
+}
+
+func TestBuffer_Overflow(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		policy          OverflowPolicy
+		expectedErr     error
+		expectedItems   []int
+		expectedDropped []int
+	}{
+		{
+			desc:            "drop newest",
+			policy:          DropNewest,
+			expectedItems:   []int{1, 2},
+			expectedDropped: []int{3, 4},
+		},
+		{
+			desc:            "drop oldest",
+			policy:          DropOldest,
+			expectedItems:   []int{3, 4},
+			expectedDropped: []int{1, 2},
+		},
+		{
+			desc:          "reject",
+			policy:        Reject,
+			expectedErr:   ErrFull,
+			expectedItems: []int{1, 2},
+		},
+	}
+	for _, impl := range implementations {
+		for _, tc := range testCases {
+			t.Run(impl.name+"/"+tc.desc, func(t *testing.T) {
+				synctest.Test(t, func(t *testing.T) {
+					var dropped []int
+
+					b := impl.new(2,
+						WithOverflow[int](tc.policy),
+						WithOnDrop(func(item int) {
+							dropped = append(dropped, item)
+						}),
+					)
+
+					for i := range 4 {
+						err := b.Put(i + 1)
+						if i < 2 {
+							assert.NoError(t, err)
+						} else {
+							assert.ErrorIs(t, err, tc.expectedErr)
+						}
+					}
+
+					b.Close()
+
+					assert.Equal(t, tc.expectedItems, b.TakeN(t.Context(), 10, 0))
+					assert.Equal(t, tc.expectedDropped, dropped)
+					assert.Equal(t, uint64(len(tc.expectedDropped)), b.Dropped())
+				})
+			})
+		}
+	}
+}
+
+func TestBuffer_OverflowPutAll(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(2, WithOverflow[int](DropOldest))
+
+				n, err := b.PutAll(t.Context(), []int{1, 2, 3, 4, 5})
+				assert.NoError(t, err)
+				assert.Equal(t, 5, n)
+				assert.Equal(t, uint64(3), b.Dropped())
+
+				b.Close()
+
+				assert.Equal(t, []int{4, 5}, b.TakeN(t.Context(), 10, 0))
+			})
+		})
+	}
+}
+
+func TestBuffer_ZeroSizeDropOldest(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				var dropped []int
+
+				b := impl.new(0,
+					WithOverflow[int](DropOldest),
+					WithOnDrop(func(item int) {
+						dropped = append(dropped, item)
+					}),
+				)
+
+				// nothing to evict so the new items are the ones dropped
+				assert.NoError(t, b.Put(1))
+				assert.NoError(t, b.Put(2))
+
+				b.Close()
+
+				assert.Empty(t, b.TakeN(t.Context(), 10, 0))
+				assert.Equal(t, []int{1, 2}, dropped)
+				assert.Equal(t, uint64(2), b.Dropped())
+			})
+		})
+	}
+}
+
+func TestBuffer_Peek(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			b := impl.new(2)
+
+			_, ok := b.Peek()
+			assert.False(t, ok)
+
+			b.PutAll(t.Context(), []int{1, 2})
+
+			// peeking doesn't take it or free up any room
+			for range 2 {
+				item, ok := b.Peek()
+				assert.True(t, ok)
+				assert.Equal(t, 1, item)
+			}
+
+			assert.Equal(t, 2, b.Len())
+			assert.ErrorIs(t, b.TryPut(3, 0), context.DeadlineExceeded)
+
+			item, err := b.Take()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, item)
+
+			assert.NoError(t, b.Put(3))
+
+			item, ok = b.Peek()
+			assert.True(t, ok)
+			assert.Equal(t, 2, item)
+
+			b.Close()
+
+			assert.Equal(t, []int{2, 3}, b.TakeN(t.Context(), 10, 0))
+		})
+	}
+}
+
+func TestBuffer_PeekWhileTaking(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			b := impl.new(4)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+			defer cancel()
+
+			var wg sync.WaitGroup
+
+			wg.Go(func() {
+				for i := range 1000 {
+					b.PutContext(ctx, i)
+				}
+			})
+
+			done := make(chan struct{})
+
+			// peek as hard as possible so it keeps racing the consumer for
+			// the next item
+			wg.Go(func() {
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						b.Peek()
+					}
+				}
+			})
+
+			var taken []int
+			for range 1000 {
+				item, err := b.TakeContext(ctx)
+				if err != nil {
+					break
+				}
+
+				taken = append(taken, item)
+			}
+
+			close(done)
+			wg.Wait()
+
+			// nothing lost, nothing out of order
+			expected := make([]int, 1000)
+			for i := range expected {
+				expected[i] = i
+			}
+
+			assert.Equal(t, expected, taken)
+		})
+	}
+}
+
+func TestBuffer_LenCap(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			b := impl.new(3)
+
+			assert.Equal(t, 0, b.Len())
+			assert.Equal(t, 3, b.Cap())
+
+			b.PutAll(t.Context(), []int{1, 2})
+
+			assert.Equal(t, 2, b.Len())
+			assert.Equal(t, 3, b.Cap())
+		})
+	}
+}
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (o *recordingObserver) record(format string, args ...any) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.events = append(o.events, fmt.Sprintf(format, args...))
+}
+
+func (o *recordingObserver) Put(n, depth int)            { o.record("put %d depth %d", n, depth) }
+func (o *recordingObserver) Take(n, depth int)           { o.record("take %d depth %d", n, depth) }
+func (o *recordingObserver) PutBlocked(d time.Duration)  { o.record("put blocked %s", d) }
+func (o *recordingObserver) TakeBlocked(d time.Duration) { o.record("take blocked %s", d) }
+func (o *recordingObserver) PutTimeout()                 { o.record("put timeout") }
+func (o *recordingObserver) TakeTimeout()                { o.record("take timeout") }
+
+func TestBuffer_Observer(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				o := &recordingObserver{}
+
+				b := impl.new(2, WithObserver[int](o))
+
+				b.Put(1)
+				b.Put(2)
+				b.TryPut(3, 1*time.Second)
+
+				go func() {
+					time.Sleep(2 * time.Second)
+					b.Take()
+				}()
+
+				b.Put(3)
+
+				b.Take()
+				b.Take()
+				b.TryTake(1 * time.Second)
+
+				assert.Equal(t, []string{
+					"put 1 depth 1",
+					"put 1 depth 2",
+					"put blocked 1s",
+					"put timeout",
+					"take 1 depth 1",
+					"put blocked 2s",
+					"put 1 depth 2",
+					"take 1 depth 1",
+					"take 1 depth 0",
+					"take blocked 1s",
+					"take timeout",
+				}, o.events)
+			})
+		})
+	}
+}
+
+func BenchmarkBuffer(b *testing.B) {
+	for _, impl := range implementations {
+		for _, producers := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("%s/producers=%d", impl.name, producers), func(b *testing.B) {
+				buf := impl.new(64)
+
+				var wg sync.WaitGroup
+				wg.Add(producers)
+
+				for p := range producers {
+					go func() {
+						defer wg.Done()
+
+						for i := p; i < b.N; i += producers {
+							buf.Put(i)
+						}
+					}()
+				}
+
+				for range b.N {
+					buf.Take()
+				}
+
+				wg.Wait()
+			})
+		}
+	}
+}
+
+func TestBuffer_PutAll(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(2)
+
+				go func() {
+					time.Sleep(1 * time.Second)
+					b.Take()
+				}()
+
+				// third item only fits once the take above frees a slot
+				n, err := b.PutAll(t.Context(), []int{1, 2, 3})
+				assert.NoError(t, err)
+				assert.Equal(t, 3, n)
+
+				ctx, cancel := context.WithTimeout(t.Context(), 1*time.Second)
+				defer cancel()
+
+				n, err = b.PutAll(ctx, []int{4, 5})
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Equal(t, 0, n)
+
+				b.Close()
+
+				n, err = b.PutAll(t.Context(), []int{4})
+				assert.ErrorIs(t, err, ErrClosed)
+				assert.Equal(t, 0, n)
+			})
+		})
+	}
+}
+
+func TestBuffer_TakeN(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		size     int
+		max      int
+		linger   time.Duration
+		puts     map[time.Duration][]int // items put after a delay
+		expected []int
+	}{
+		{
+			desc: "returns what is available without linger",
+			size: 10,
+			max:  5,
+			puts: map[time.Duration][]int{
+				0:           {1, 2},
+				time.Second: {3},
+			},
+			expected: []int{1, 2},
+		},
+		{
+			desc: "caps batch at max",
+			size: 10,
+			max:  2,
+			puts: map[time.Duration][]int{
+				0: {1, 2, 3},
+			},
+			expected: []int{1, 2},
+		},
+		{
+			desc: "waits for the first item",
+			size: 10,
+			max:  5,
+			puts: map[time.Duration][]int{
+				time.Second: {1, 2},
+			},
+			expected: []int{1, 2},
+		},
+		{
+			desc:   "lingers to fill the batch",
+			size:   10,
+			max:    3,
+			linger: 2 * time.Second,
+			puts: map[time.Duration][]int{
+				0:           {1},
+				time.Second: {2, 3, 4},
+			},
+			expected: []int{1, 2, 3},
+		},
+		{
+			desc:   "returns partial batch after linger",
+			size:   10,
+			max:    3,
+			linger: 2 * time.Second,
+			puts: map[time.Duration][]int{
+				0:               {1},
+				time.Second:     {2},
+				3 * time.Second: {3},
+			},
+			expected: []int{1, 2},
+		},
+		{
+			desc:   "lingers past capacity of the buffer",
+			size:   1,
+			max:    3,
+			linger: 2 * time.Second,
+			puts: map[time.Duration][]int{
+				0:           {1},
+				time.Second: {2, 3},
+			},
+			expected: []int{1, 2, 3},
+		},
+	}
+	for _, impl := range implementations {
+		for _, tc := range testCases {
+			t.Run(impl.name+"/"+tc.desc, func(t *testing.T) {
+				synctest.Test(t, func(t *testing.T) {
+					b := impl.new(tc.size)
+
+					var wg sync.WaitGroup
+					for delay, items := range tc.puts {
+						wg.Go(func() {
+							time.Sleep(delay)
+							b.PutAll(t.Context(), items)
+						})
+					}
+
+					synctest.Wait()
+
+					actual := b.TakeN(t.Context(), tc.max, tc.linger)
+
+					assert.Equal(t, tc.expected, actual)
+
+					b.Close()
+					wg.Wait()
+				})
+			})
+		}
+	}
+}
+
+func TestBuffer_TakeNClosed(t *testing.T) {
+	for _, impl := range implementations {
+		t.Run(impl.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				b := impl.new(2)
+
+				b.Put(1)
+				b.Close()
+
+				assert.Equal(t, []int{1}, b.TakeN(t.Context(), 5, time.Second))
+				assert.Empty(t, b.TakeN(t.Context(), 5, time.Second))
+			})
+		})
+	}
+}
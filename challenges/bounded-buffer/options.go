@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy decides what a put does when the buffer is full
+type OverflowPolicy int
+
+const (
+	// Block waits until there is space, this is the default
+	Block OverflowPolicy = iota
+	// DropNewest discards the item being put
+	DropNewest
+	// DropOldest evicts the oldest item in the buffer to make room, or the
+	// lowest priority one for a PriorityBuffer
+	DropOldest
+	// Reject fails the put with ErrFull
+	Reject
+)
+
+// ErrFull is returned by puts to a full buffer using the Reject policy
+var ErrFull = errors.New("buffer full")
+
+type Option[T any] func(*options[T])
+
+// WithOverflow sets what happens when putting to a full buffer
+func WithOverflow[T any](policy OverflowPolicy) Option[T] {
+	return func(o *options[T]) {
+		o.overflow = policy
+	}
+}
+
+// WithOnDrop registers f to be called with every item discarded by the
+// overflow policy. It is never called while the buffer is locked so it is
+// safe to use the buffer from within f
+func WithOnDrop[T any](f func(T)) Option[T] {
+	return func(o *options[T]) {
+		o.onDrop = f
+	}
+}
+
+// Observer is told what a buffer is doing so it can be wired up to metrics.
+// Methods are called synchronously but never while the buffer is locked, so
+// they should be quick but are free to use the buffer
+type Observer interface {
+	// Put is called when n items were added, leaving depth items in the buffer
+	Put(n, depth int)
+	// Take is called when n items were removed, leaving depth items in the buffer
+	Take(n, depth int)
+	// PutBlocked is called with how long a put had to wait for space
+	PutBlocked(d time.Duration)
+	// TakeBlocked is called with how long a take had to wait for an item
+	TakeBlocked(d time.Duration)
+	// PutTimeout is called when TryPut gives up
+	PutTimeout()
+	// TakeTimeout is called when TryTake gives up
+	TakeTimeout()
+}
+
+// WithObserver reports the buffer's activity to o
+func WithObserver[T any](o Observer) Option[T] {
+	return func(opts *options[T]) {
+		opts.observer = o
+	}
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Put(n, depth int)            {}
+func (nopObserver) Take(n, depth int)           {}
+func (nopObserver) PutBlocked(d time.Duration)  {}
+func (nopObserver) TakeBlocked(d time.Duration) {}
+func (nopObserver) PutTimeout()                 {}
+func (nopObserver) TakeTimeout()                {}
+
+type options[T any] struct {
+	overflow OverflowPolicy
+	onDrop   func(T)
+	dropped  *atomic.Uint64
+	observer Observer
+}
+
+func newOptions[T any](opts []Option[T]) options[T] {
+	o := options[T]{
+		overflow: Block,
+		dropped:  &atomic.Uint64{},
+		observer: nopObserver{},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+func (o options[T]) drop(items ...T) {
+	o.dropped.Add(uint64(len(items)))
+
+	if o.onDrop == nil {
+		return
+	}
+
+	for _, item := range items {
+		o.onDrop(item)
+	}
+}
+
+// events collects what happened during a single operation so the observer and
+// onDrop can be told once the buffer has been unlocked
+type events[T any] struct {
+	put         int
+	taken       int
+	depth       int
+	putBlocked  time.Duration
+	takeBlocked time.Duration
+	dropped     []T
+}
+
+func (o options[T]) report(e *events[T]) {
+	o.drop(e.dropped...)
+
+	if e.putBlocked > 0 {
+		o.observer.PutBlocked(e.putBlocked)
+	}
+
+	if e.takeBlocked > 0 {
+		o.observer.TakeBlocked(e.takeBlocked)
+	}
+
+	if e.put > 0 {
+		o.observer.Put(e.put, e.depth)
+	}
+
+	if e.taken > 0 {
+		o.observer.Take(e.taken, e.depth)
+	}
+}
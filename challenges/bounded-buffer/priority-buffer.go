@@ -0,0 +1,104 @@
+package main
+
+import "container/heap"
+
+// PriorityBuffer is a bounded buffer that hands out the highest priority item
+// first instead of the oldest. Items of equal priority come out in the order
+// they were put
+type PriorityBuffer[T any] struct {
+	*condBuffer[T]
+}
+
+// NewPriorityBuffer creates a PriorityBuffer where less reports whether a has a
+// higher priority than b and so should be taken first. With the DropOldest
+// overflow policy the lowest priority item is the one evicted
+func NewPriorityBuffer[T any](size int, less func(a, b T) bool, opts ...Option[T]) *PriorityBuffer[T] {
+	return &PriorityBuffer[T]{
+		condBuffer: newCondBuffer[T](newPriorityQueue(size, less), size, opts),
+	}
+}
+
+type prioritized[T any] struct {
+	item T
+	seq  uint64 // breaks ties so equal priorities are fifo
+}
+
+type priorityQueue[T any] struct {
+	entries []prioritized[T]
+	less    func(a, b T) bool
+	seq     uint64
+}
+
+func newPriorityQueue[T any](size int, less func(a, b T) bool) *priorityQueue[T] {
+	return &priorityQueue[T]{
+		entries: make([]prioritized[T], 0, size),
+		less:    less,
+	}
+}
+
+func (q *priorityQueue[T]) push(item T) {
+	heap.Push(q, prioritized[T]{item: item, seq: q.seq})
+	q.seq++
+}
+
+func (q *priorityQueue[T]) pop() T {
+	return heap.Pop(q).(prioritized[T]).item
+}
+
+func (q *priorityQueue[T]) peek() T {
+	return q.entries[0].item
+}
+
+func (q *priorityQueue[T]) evict() T {
+	// the last item out is somewhere in the heap so we have to look for it
+	last := 0
+	for i := range q.entries {
+		if q.Less(last, i) {
+			last = i
+		}
+	}
+
+	return heap.Remove(q, last).(prioritized[T]).item
+}
+
+func (q *priorityQueue[T]) len() int {
+	return len(q.entries)
+}
+
+// heap.Interface, use push/pop above instead of these
+
+func (q *priorityQueue[T]) Len() int {
+	return len(q.entries)
+}
+
+func (q *priorityQueue[T]) Less(i, j int) bool {
+	a, b := q.entries[i], q.entries[j]
+
+	if q.less(a.item, b.item) {
+		return true
+	}
+
+	if q.less(b.item, a.item) {
+		return false
+	}
+
+	return a.seq < b.seq
+}
+
+func (q *priorityQueue[T]) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+}
+
+func (q *priorityQueue[T]) Push(x any) {
+	q.entries = append(q.entries, x.(prioritized[T]))
+}
+
+func (q *priorityQueue[T]) Pop() any {
+	n := len(q.entries) - 1
+
+	entry := q.entries[n]
+	q.entries[n] = prioritized[T]{} // don't hold on to references for the gc
+	q.entries = q.entries[:n]
+
+	return entry
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type job struct {
+	name     string
+	priority int
+}
+
+func byPriority(a, b job) bool {
+	return a.priority > b.priority
+}
+
+func TestPriorityBuffer_Order(t *testing.T) {
+	b := NewPriorityBuffer(10, byPriority)
+
+	b.PutAll(t.Context(), []job{
+		{name: "a", priority: 1},
+		{name: "b", priority: 3},
+		{name: "c", priority: 2},
+		{name: "d", priority: 3},
+		{name: "e", priority: 1},
+		{name: "f", priority: 2},
+	})
+	b.Close()
+
+	var actual []string
+	for j := range b.All() {
+		actual = append(actual, j.name)
+	}
+
+	// equal priorities keep the order they were put in
+	assert.Equal(t, []string{"b", "d", "c", "f", "a", "e"}, actual)
+}
+
+func TestPriorityBuffer_Blocking(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewPriorityBuffer(2, byPriority)
+
+		b.Put(job{name: "a", priority: 1})
+		b.Put(job{name: "b", priority: 1})
+
+		err := b.TryPut(job{name: "c", priority: 5}, 1*time.Second)
+		assert.Error(t, err)
+
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.Take()
+		}()
+
+		// blocks until the take above makes room
+		err = b.Put(job{name: "c", priority: 5})
+		assert.NoError(t, err)
+
+		j, err := b.Take()
+		assert.NoError(t, err)
+		assert.Equal(t, "c", j.name)
+	})
+}
+
+func TestPriorityBuffer_DropOldestEvictsLowestPriority(t *testing.T) {
+	var dropped []string
+
+	b := NewPriorityBuffer(3, byPriority,
+		WithOverflow[job](DropOldest),
+		WithOnDrop(func(j job) {
+			dropped = append(dropped, j.name)
+		}),
+	)
+
+	b.PutAll(t.Context(), []job{
+		{name: "a", priority: 2},
+		{name: "b", priority: 1},
+		{name: "c", priority: 1},
+		{name: "d", priority: 3},
+		{name: "e", priority: 3},
+	})
+	b.Close()
+
+	var actual []string
+	for j := range b.All() {
+		actual = append(actual, j.name)
+	}
+
+	// of the two lowest priority items the newer one would be taken last
+	assert.Equal(t, []string{"c", "b"}, dropped)
+	assert.Equal(t, []string{"d", "e", "a"}, actual)
+}
+
+func TestPriorityBuffer_ZeroSizeDropOldest(t *testing.T) {
+	b := NewPriorityBuffer(0, byPriority, WithOverflow[job](DropOldest))
+
+	assert.NoError(t, b.Put(job{name: "a", priority: 1}))
+
+	assert.Equal(t, 0, b.Len())
+	assert.Equal(t, uint64(1), b.Dropped())
+}
+
+func TestPriorityBuffer_Peek(t *testing.T) {
+	b := NewPriorityBuffer(10, byPriority)
+
+	b.Put(job{name: "a", priority: 1})
+	b.Put(job{name: "b", priority: 2})
+
+	j, ok := b.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "b", j.name)
+	assert.Equal(t, 2, b.Len())
+}
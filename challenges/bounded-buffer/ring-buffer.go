@@ -0,0 +1,71 @@
+package main
+
+// RingBuffer is a bounded buffer backed by a slice used as a circular queue,
+// with sync.Cond used to block producers and consumers. Unlike BoundedBuffer
+// its capacity can be changed with Resize and the next item can be peeked at
+type RingBuffer[T any] struct {
+	*condBuffer[T]
+}
+
+func NewRingBuffer[T any](size int, opts ...Option[T]) *RingBuffer[T] {
+	return &RingBuffer[T]{
+		condBuffer: newCondBuffer[T](newRing[T](size), size, opts),
+	}
+}
+
+type ring[T any] struct {
+	items []T
+	head  int // index of the oldest item
+	count int
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{
+		items: make([]T, size),
+	}
+}
+
+func (r *ring[T]) push(item T) {
+	if r.count == len(r.items) {
+		// only happens after the buffer has been resized to be bigger
+		r.grow()
+	}
+
+	r.items[(r.head+r.count)%len(r.items)] = item
+	r.count++
+}
+
+func (r *ring[T]) pop() T {
+	var zero T
+
+	item := r.items[r.head]
+	r.items[r.head] = zero // don't hold on to references for the gc
+	r.head = (r.head + 1) % len(r.items)
+	r.count--
+
+	return item
+}
+
+func (r *ring[T]) peek() T {
+	return r.items[r.head]
+}
+
+func (r *ring[T]) evict() T {
+	// the oldest item is the one that gets evicted
+	return r.pop()
+}
+
+func (r *ring[T]) grow() {
+	items := make([]T, max(2*len(r.items), 1))
+
+	// unwrap so the oldest item is at the start again
+	n := copy(items, r.items[r.head:])
+	copy(items[n:], r.items[:r.head])
+
+	r.items = items
+	r.head = 0
+}
+
+func (r *ring[T]) len() int {
+	return r.count
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBuffer_ResizeGrow(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewRingBuffer[int](2)
+
+		// move the head so growing has to unwrap the ring
+		b.PutAll(t.Context(), []int{1, 2})
+		b.Take()
+		b.Put(3)
+
+		var wg sync.WaitGroup
+		for i := range 3 {
+			wg.Go(func() {
+				b.Put(4 + i)
+			})
+
+			synctest.Wait()
+		}
+
+		b.Resize(5)
+
+		// all blocked producers fit now
+		wg.Wait()
+
+		b.Close()
+
+		items := b.TakeN(t.Context(), 10, 0)
+
+		// woken producers can be scheduled in any order
+		assert.Equal(t, []int{2, 3}, items[:2])
+		assert.ElementsMatch(t, []int{4, 5, 6}, items[2:])
+	})
+}
+
+func TestRingBuffer_ResizeShrink(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := NewRingBuffer[int](4)
+
+		b.PutAll(t.Context(), []int{1, 2, 3, 4})
+
+		b.Resize(2)
+
+		// nothing is lost but there is no room until we drain below 2
+		err := b.TryPut(5, 1*time.Second)
+		assert.Error(t, err)
+
+		b.Take()
+		b.Take()
+
+		err = b.TryPut(5, 1*time.Second)
+		assert.Error(t, err)
+
+		b.Take()
+
+		err = b.TryPut(5, 1*time.Second)
+		assert.NoError(t, err)
+
+		b.Close()
+
+		assert.Equal(t, []int{4, 5}, b.TakeN(t.Context(), 10, 0))
+	})
+}
+
+func TestRingBuffer_ResizeShrinkDropOldest(t *testing.T) {
+	b := NewRingBuffer(4, WithOverflow[int](DropOldest))
+
+	b.PutAll(t.Context(), []int{1, 2, 3, 4})
+
+	b.Resize(2)
+
+	// evicting keeps the size where it is rather than shrinking it
+	b.Put(5)
+
+	b.Close()
+
+	assert.Equal(t, uint64(1), b.Dropped())
+	assert.Equal(t, []int{2, 3, 4, 5}, b.TakeN(t.Context(), 10, 0))
+}
+
+func TestRingBuffer_ResizeZeroDropOldest(t *testing.T) {
+	b := NewRingBuffer(2, WithOverflow[int](DropOldest))
+
+	b.Resize(0)
+
+	// the buffer holds nothing so every put is dropped without evicting
+	assert.NoError(t, b.Put(1))
+	assert.NoError(t, b.Put(2))
+
+	assert.Equal(t, 0, b.Len())
+	assert.Equal(t, uint64(2), b.Dropped())
+
+	// still works once there is room again
+	b.Resize(1)
+	assert.NoError(t, b.Put(3))
+
+	b.Close()
+
+	assert.Equal(t, []int{3}, b.TakeN(t.Context(), 10, 0))
+}
+
+func TestRingBuffer_Introspection(t *testing.T) {
+	b := NewRingBuffer[int](4)
+
+	_, ok := b.Peek()
+	assert.False(t, ok)
+
+	b.PutAll(t.Context(), []int{1, 2, 3})
+
+	item, ok := b.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, 1, item)
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, 4, b.Cap())
+
+	b.Resize(2)
+
+	assert.Equal(t, 3, b.Len())
+	assert.Equal(t, 2, b.Cap())
+
+	// peeking doesn't take anything
+	item, _ = b.Take()
+	assert.Equal(t, 1, item)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// SelectTake takes an item from whichever of buffers has one first, blocking
+// until one does or ctx is done. The index of the buffer the item came from is
+// returned with it. When several buffers have items ready one is picked at
+// random so none of them get starved. ErrClosed is returned once every buffer
+// is closed and drained
+func SelectTake[T any](ctx context.Context, buffers ...buffer[T]) (T, int, error) {
+	weights := make([]int, len(buffers))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	return WeightedSelectTake(ctx, weights, buffers...)
+}
+
+// WeightedSelectTake is SelectTake where, when several buffers have items
+// ready, buffer i is picked with a probability proportional to weights[i]. A
+// buffer with a low weight is picked less often but is never starved
+func WeightedSelectTake[T any](ctx context.Context, weights []int, buffers ...buffer[T]) (T, int, error) {
+	var zero T
+
+	if len(weights) != len(buffers) {
+		return zero, -1, errors.New("need exactly one weight per buffer")
+	}
+
+	for _, w := range weights {
+		if w <= 0 {
+			return zero, -1, errors.New("weights must be positive")
+		}
+	}
+
+	// watch before the first poll so an item put right after we looked
+	// still wakes us up
+	notify := make(chan struct{}, 1)
+	for _, b := range buffers {
+		unwatch := b.watch(notify)
+		defer unwatch()
+	}
+
+	closed := make([]bool, len(buffers))
+
+	for {
+		for _, i := range weightedOrder(weights, closed) {
+			item, ok, err := buffers[i].tryTake()
+			if errors.Is(err, ErrClosed) {
+				closed[i] = true
+				continue
+			}
+
+			if ok {
+				return item, i, nil
+			}
+		}
+
+		if !slices.Contains(closed, false) {
+			return zero, -1, ErrClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, -1, ctx.Err()
+		case <-notify:
+		}
+	}
+}
+
+// weightedOrder returns the indexes of the buffers that aren't closed, shuffled
+// so that higher weights tend to come first
+func weightedOrder(weights []int, closed []bool) []int {
+	order := make([]int, 0, len(weights))
+	total := 0
+
+	for i, w := range weights {
+		if closed[i] {
+			continue
+		}
+
+		order = append(order, i)
+		total += w
+	}
+
+	// pick without replacement, each pick filling the next position
+	for pos := range order {
+		r := rand.IntN(total)
+
+		for j := pos; j < len(order); j++ {
+			r -= weights[order[j]]
+			if r < 0 {
+				order[pos], order[j] = order[j], order[pos]
+				break
+			}
+		}
+
+		total -= weights[order[pos]]
+	}
+
+	return order
+}
+
+// watchers is the set of channels that want to know when a buffer might have
+// something to take, either because an item was put or it was closed
+type watchers struct {
+	mu    *sync.Mutex
+	chans map[chan<- struct{}]struct{}
+	n     *atomic.Int32 // lets notify skip the lock when nobody is watching
+}
+
+func newWatchers() *watchers {
+	return &watchers{
+		mu:    &sync.Mutex{},
+		chans: make(map[chan<- struct{}]struct{}),
+		n:     &atomic.Int32{},
+	}
+}
+
+// add registers c, which should be buffered so notify never has to block
+func (w *watchers) add(c chan<- struct{}) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.chans[c] = struct{}{}
+	w.n.Add(1)
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.chans, c)
+		w.n.Add(-1)
+	}
+}
+
+func (w *watchers) notify() {
+	if w.n.Load() == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for c := range w.chans {
+		select {
+		case c <- struct{}{}:
+		default:
+			// already has a pending notification
+		}
+	}
+}
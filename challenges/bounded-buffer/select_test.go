@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectTake(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		a := NewBoundedBuffer[int](2)
+		b := NewRingBuffer[int](2)
+
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.Put(1)
+		}()
+
+		// blocks until something is put in either buffer
+		item, i, err := SelectTake(t.Context(), a, b)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, item)
+		assert.Equal(t, 1, i)
+
+		go func() {
+			time.Sleep(1 * time.Second)
+			a.Put(2)
+		}()
+
+		item, i, err = SelectTake(t.Context(), a, b)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, item)
+		assert.Equal(t, 0, i)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 1*time.Second)
+		defer cancel()
+
+		_, _, err = SelectTake(ctx, a, b)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestSelectTake_Closed(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		a := NewBoundedBuffer[int](2)
+		b := NewRingBuffer[int](2)
+
+		a.Put(1)
+		a.Close()
+
+		item, i, err := SelectTake(t.Context(), a, b)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, item)
+		assert.Equal(t, 0, i)
+
+		go func() {
+			time.Sleep(1 * time.Second)
+			b.Close()
+		}()
+
+		// only gives up once every buffer is closed and drained
+		_, _, err = SelectTake(t.Context(), a, b)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+func TestWeightedSelectTake(t *testing.T) {
+	busy := NewRingBuffer[int](10_000)
+	quiet := NewRingBuffer[int](10_000)
+
+	for i := range 10_000 {
+		busy.Put(i)
+		quiet.Put(i)
+	}
+
+	counts := make([]int, 2)
+	for range 10_000 {
+		_, i, err := WeightedSelectTake(t.Context(), []int{9, 1}, busy, quiet)
+		assert.NoError(t, err)
+
+		counts[i]++
+	}
+
+	// roughly 9000 and 1000, the quiet buffer still gets its turn
+	assert.InDelta(t, 9000, counts[0], 300)
+	assert.InDelta(t, 1000, counts[1], 300)
+}
+
+func TestWeightedSelectTake_InvalidWeights(t *testing.T) {
+	a := NewRingBuffer[int](1)
+
+	_, _, err := WeightedSelectTake(t.Context(), []int{1, 1}, a)
+	assert.Error(t, err)
+
+	_, _, err = WeightedSelectTake(t.Context(), []int{0}, a)
+	assert.Error(t, err)
+}
@@ -0,0 +1,178 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WithCache keeps successful results around for ttl so downloading the same
+// url again within that time, from any call on the Downloader, doesn't fetch
+// it again. Failures are never cached
+func WithCache(ttl time.Duration) Option {
+	return func(d *Downloader) {
+		d.cache = newCache(ttl)
+	}
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+type cache struct {
+	ttl       time.Duration
+	entries   map[string]cacheEntry
+	lastSweep time.Time
+	mu        *sync.Mutex
+}
+
+func newCache(ttl time.Duration) *cache {
+	return &cache{
+		ttl:       ttl,
+		entries:   make(map[string]cacheEntry),
+		lastSweep: time.Now(),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (c *cache) get(url string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok {
+		return Result{}, false
+	}
+
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, url)
+		return Result{}, false
+	}
+
+	return entry.result, true
+}
+
+func (c *cache) put(url string, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	// urls that are never asked for again would otherwise stay forever, so
+	// every ttl clear out whatever has expired
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for url, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, url)
+			}
+		}
+
+		c.lastSweep = now
+	}
+
+	c.entries[url] = cacheEntry{
+		result:  result,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// flight is a fetch of a url that others can wait on instead of fetching it
+// themselves
+type flight struct {
+	done   chan struct{}
+	result Result
+}
+
+type flights struct {
+	inFlight map[string]*flight
+	mu       *sync.Mutex
+}
+
+func newFlights() *flights {
+	return &flights{
+		inFlight: make(map[string]*flight),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// join returns the flight for url, starting one if there isn't one already.
+// leader is true if it was started, in which case the caller has to do the
+// fetch and land it
+func (f *flights) join(url string) (fl *flight, leader bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fl, ok := f.inFlight[url]
+	if ok {
+		return fl, false
+	}
+
+	fl = &flight{done: make(chan struct{})}
+	f.inFlight[url] = fl
+
+	return fl, true
+}
+
+// land hands result to everyone waiting on fl
+func (f *flights) land(url string, fl *flight, result Result) {
+	f.mu.Lock()
+	delete(f.inFlight, url)
+	f.mu.Unlock()
+
+	fl.result = result
+	close(fl.done)
+}
+
+// download returns the result for url from the cache if it is there,
+// otherwise it fetches it. Concurrent downloads of the same url share a single
+// fetch, done by whoever asked first
+func (d *Downloader) download(ctx context.Context, url string) Result {
+	start := time.Now()
+
+	for {
+		if d.cache != nil {
+			result, ok := d.cache.get(url)
+			if ok {
+				result.Cached = true
+				return result
+			}
+		}
+
+		fl, leader := d.flights.join(url)
+		if leader {
+			result := d.fetch(ctx, url)
+			if result.Err == nil && d.cache != nil {
+				d.cache.put(url, result)
+			}
+
+			d.flights.land(url, fl, result)
+
+			return result
+		}
+
+		select {
+		case <-ctx.Done():
+			// the leader still gets its result, we just stop waiting for it
+			return Result{
+				URL:      url,
+				Err:      ctx.Err(),
+				Duration: time.Since(start),
+			}
+		case <-fl.done:
+		}
+
+		// the fetch we joined was cancelled by whoever started it, that says
+		// nothing about ours so go again
+		if isContextErr(fl.result.Err) && ctx.Err() == nil {
+			continue
+		}
+
+		return fl.result
+	}
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,164 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// counting returns a fetcher that takes 100ms and counts how many times each
+// url was fetched
+func counting(fetches *sync.Map) Fetcher {
+	return FetcherFunc(func(ctx context.Context, url string) (int, error) {
+		n, _ := fetches.LoadOrStore(url, &atomic.Int32{})
+		n.(*atomic.Int32).Add(1)
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			return 1, nil
+		}
+	})
+}
+
+func fetchCount(fetches *sync.Map, url string) int32 {
+	n, ok := fetches.Load(url)
+	if !ok {
+		return 0
+	}
+
+	return n.(*atomic.Int32).Load()
+}
+
+func TestDownloadAll_Duplicates(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var fetches sync.Map
+
+		report := New(counting(&fetches)).DownloadAll(t.Context(), []string{"a", "b", "a", "a", "b"})
+
+		assert.NoError(t, report.Err())
+		assert.Len(t, report.Results, 2)
+		assert.Equal(t, 2, report.Succeeded)
+		assert.Equal(t, 2, report.Sum)
+		assert.Equal(t, int32(1), fetchCount(&fetches, "a"))
+		assert.Equal(t, int32(1), fetchCount(&fetches, "b"))
+	})
+}
+
+func TestDownloadAll_ConcurrentCallsShareFetch(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var fetches sync.Map
+
+		d := New(counting(&fetches))
+
+		var wg sync.WaitGroup
+		reports := make([]Report, 5)
+
+		for i := range reports {
+			wg.Go(func() {
+				reports[i] = d.DownloadAll(t.Context(), []string{"a"})
+			})
+		}
+
+		wg.Wait()
+
+		for _, report := range reports {
+			assert.NoError(t, report.Err())
+			assert.Equal(t, 1, report.Sum)
+		}
+
+		assert.Equal(t, int32(1), fetchCount(&fetches, "a"))
+	})
+}
+
+func TestDownloadAll_Cache(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var fetches sync.Map
+
+		d := New(counting(&fetches), WithCache(time.Minute))
+
+		report := d.DownloadAll(t.Context(), []string{"a"})
+		assert.NoError(t, report.Err())
+		assert.False(t, report.Results["a"].Cached)
+
+		time.Sleep(30 * time.Second)
+
+		report = d.DownloadAll(t.Context(), []string{"a"})
+		assert.NoError(t, report.Err())
+		assert.True(t, report.Results["a"].Cached)
+		assert.Equal(t, 1, report.Sum)
+		assert.Equal(t, int32(1), fetchCount(&fetches, "a"))
+
+		// expired so it is fetched again
+		time.Sleep(time.Minute)
+
+		report = d.DownloadAll(t.Context(), []string{"a"})
+		assert.NoError(t, report.Err())
+		assert.False(t, report.Results["a"].Cached)
+		assert.Equal(t, int32(2), fetchCount(&fetches, "a"))
+	})
+}
+
+func TestDownloadAll_CacheSkipsFailures(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		errBroken := errors.New("broken")
+
+		var attempts atomic.Int32
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			if attempts.Add(1) == 1 {
+				return 0, errBroken
+			}
+
+			return 1, nil
+		})
+
+		d := New(f, WithCache(time.Minute))
+
+		report := d.DownloadAll(t.Context(), []string{"a"})
+		assert.ErrorIs(t, report.Err(), errBroken)
+
+		report = d.DownloadAll(t.Context(), []string{"a"})
+		assert.NoError(t, report.Err())
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+}
+
+func TestDownloadAll_SharedFetchCancelled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var fetches sync.Map
+
+		d := New(counting(&fetches))
+
+		// starts the fetch and gives up on it half way through
+		leader, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+
+		var wg sync.WaitGroup
+		var leaderReport Report
+
+		wg.Go(func() {
+			leaderReport = d.DownloadAll(leader, []string{"a"})
+		})
+
+		synctest.Wait()
+
+		// joins the fetch already in flight
+		report := d.DownloadAll(t.Context(), []string{"a"})
+
+		wg.Wait()
+
+		assert.ErrorIs(t, leaderReport.Err(), context.DeadlineExceeded)
+
+		// the cancellation wasn't ours so it went again
+		assert.NoError(t, report.Err())
+		assert.Equal(t, int32(2), fetchCount(&fetches, "a"))
+	})
+}
@@ -0,0 +1,200 @@
+package downloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Checkpoint remembers every url that was downloaded successfully in a file,
+// one JSON object per line, so a run that dies part way through can pick up
+// where it left off. Failures aren't written so they are tried again
+type Checkpoint struct {
+	results map[string]Result
+	file    *os.File
+	err     error // first write that failed
+	mu      *sync.Mutex
+}
+
+// WithCheckpoint skips urls c already has a result for, yielding that result
+// instead, and writes every new successful result to it
+func WithCheckpoint(c *Checkpoint) Option {
+	return func(d *Downloader) {
+		d.checkpoint = c
+	}
+}
+
+type checkpointRecord struct {
+	URL      string        `json:"url"`
+	Value    int           `json:"value"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts"`
+}
+
+// OpenCheckpoint opens the checkpoint at path, creating it if it doesn't exist,
+// and loads the results already in it
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	results, err := loadCheckpoint(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading checkpoint: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+
+	err = endLine(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+
+	return &Checkpoint{
+		results: results,
+		file:    file,
+		mu:      &sync.Mutex{},
+	}, nil
+}
+
+func loadCheckpoint(path string) (map[string]Result, error) {
+	results := make(map[string]Result)
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return results, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r checkpointRecord
+
+		err := json.Unmarshal(s.Bytes(), &r)
+		if err != nil {
+			// a line that was only partially written when the process died,
+			// that url just gets downloaded again
+			continue
+		}
+
+		results[r.URL] = Result{
+			URL:      r.URL,
+			Value:    r.Value,
+			Duration: r.Duration,
+			Attempts: r.Attempts,
+			Resumed:  true,
+		}
+	}
+
+	return results, s.Err()
+}
+
+// endLine makes sure f ends in a newline so the next record doesn't get glued
+// on to a torn one
+func endLine(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+
+	last := make([]byte, 1)
+
+	_, err = f.ReadAt(last, info.Size()-1)
+	if err != nil || last[0] == '\n' {
+		return err
+	}
+
+	_, err = f.Write([]byte{'\n'})
+
+	return err
+}
+
+// Len returns how many urls have a result in the checkpoint
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.results)
+}
+
+// Close closes the file and returns the first error hit writing to it, if any.
+// Results that failed to be written are downloaded again next time
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return errors.Join(c.err, c.file.Close())
+}
+
+// split separates urls into the results the checkpoint already has and the
+// urls that still need downloading
+func (c *Checkpoint) split(urls []string) ([]Result, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var done []Result
+	var todo []string
+
+	seen := make(map[string]bool, len(urls))
+
+	for _, url := range urls {
+		result, ok := c.results[url]
+		if !ok {
+			todo = append(todo, url)
+			continue
+		}
+
+		if !seen[url] {
+			seen[url] = true
+			done = append(done, result)
+		}
+	}
+
+	return done, todo
+}
+
+// record writes result to the checkpoint if it succeeded. Once a write fails
+// nothing more is written, Close reports why
+func (c *Checkpoint) record(result Result) {
+	if result.Err != nil {
+		return
+	}
+
+	data, err := json.Marshal(checkpointRecord{
+		URL:      result.URL,
+		Value:    result.Value,
+		Duration: result.Duration,
+		Attempts: result.Attempts,
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	if err == nil {
+		_, err = c.file.Write(append(data, '\n'))
+	}
+
+	if err == nil {
+		err = c.file.Sync()
+	}
+
+	if err != nil {
+		c.err = fmt.Errorf("writing %s: %w", result.URL, err)
+		return
+	}
+
+	result.Resumed = true
+	c.results[result.URL] = result
+}
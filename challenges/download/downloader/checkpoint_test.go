@@ -0,0 +1,131 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"testing/synctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAll_Checkpoint(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+
+		errBroken := errors.New("broken")
+
+		var mu sync.Mutex
+		var fetched []string
+
+		// fails url_1 and url_3 the first time round
+		broken := map[string]bool{"url_1": true, "url_3": true}
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			fetched = append(fetched, url)
+
+			if broken[url] {
+				delete(broken, url)
+				return 0, errBroken
+			}
+
+			return 1, nil
+		})
+
+		c, err := OpenCheckpoint(path)
+		require.NoError(t, err)
+
+		report := New(f, WithCheckpoint(c)).DownloadAll(t.Context(), urls(5))
+		assert.Equal(t, 3, report.Succeeded)
+		assert.Equal(t, 2, report.Failed)
+		require.NoError(t, c.Close())
+
+		// pick up where the last run left off
+		fetched = nil
+
+		c, err = OpenCheckpoint(path)
+		require.NoError(t, err)
+		defer c.Close()
+
+		assert.Equal(t, 3, c.Len())
+
+		report = New(f, WithCheckpoint(c)).DownloadAll(t.Context(), urls(5))
+		assert.NoError(t, report.Err())
+		assert.Equal(t, 5, report.Succeeded)
+		assert.Equal(t, 5, report.Sum)
+
+		slices.Sort(fetched)
+		assert.Equal(t, []string{"url_1", "url_3"}, fetched)
+
+		assert.True(t, report.Results["url_0"].Resumed)
+		assert.Equal(t, 1, report.Results["url_0"].Attempts)
+		assert.False(t, report.Results["url_1"].Resumed)
+
+		assert.Equal(t, 5, c.Len())
+	})
+}
+
+func TestStream_CheckpointRangedTwice(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c, err := OpenCheckpoint(filepath.Join(t.TempDir(), "checkpoint.jsonl"))
+		require.NoError(t, err)
+		defer c.Close()
+
+		c.record(Result{URL: "url_0", Value: 1, Attempts: 1})
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			return 1, nil
+		})
+
+		seq := New(f, WithCheckpoint(c)).Stream(t.Context(), urls(2))
+
+		// the second time round url_1 is in the checkpoint too but url_0
+		// must not be forgotten
+		for range 2 {
+			var got []string
+			for url := range seq {
+				got = append(got, url)
+			}
+
+			assert.ElementsMatch(t, []string{"url_0", "url_1"}, got)
+		}
+	})
+}
+
+func TestOpenCheckpoint_TornWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+
+	data := `{"url":"a","value":1,"duration":0,"attempts":1}
+{"url":"b","value":2,"duration":0,"attempts":1}
+{"url":"c","val`
+
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+	c, err := OpenCheckpoint(path)
+	require.NoError(t, err)
+
+	// the torn line is dropped and c is downloaded again
+	assert.Equal(t, 2, c.Len())
+
+	results, todo := c.split([]string{"a", "b", "c", "a"})
+	assert.Len(t, results, 2)
+	assert.Equal(t, []string{"c"}, todo)
+
+	// new records aren't lost to the torn one
+	c.record(Result{URL: "c", Value: 3, Attempts: 1})
+	require.NoError(t, c.Close())
+
+	c, err = OpenCheckpoint(path)
+	require.NoError(t, err)
+	defer c.Close()
+
+	assert.Equal(t, 3, c.Len())
+}
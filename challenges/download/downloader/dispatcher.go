@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// WithKeyLimit caps how many urls sharing the same key are downloaded at the
+// same time, on top of the overall WithMaxWorkers cap. key is called with
+// every url, HostKey is a good default
+func WithKeyLimit(key func(url string) string, n int) Option {
+	return func(d *Downloader) {
+		d.key = key
+		d.keyLimit = n
+	}
+}
+
+// HostKey returns the host of rawURL, or rawURL itself if it can't be parsed
+func HostKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	return u.Host
+}
+
+// dispatcher hands urls out to workers. Urls are grouped by key and the keys
+// take turns so a key that is at its limit never holds up the others
+type dispatcher struct {
+	key   func(url string) string
+	limit int // 0 means no limit
+	total int // distinct urls
+
+	keys    []string // keys with urls still pending, in the order first seen
+	cursor  int      // index into keys of whose turn it is
+	pending map[string][]string
+	active  map[string]int
+	stopped bool
+
+	mu   *sync.Mutex
+	cond *sync.Cond
+}
+
+func newDispatcher(urls []string, key func(url string) string, limit int) *dispatcher {
+	if key == nil {
+		key = func(string) string { return "" }
+	}
+
+	mu := &sync.Mutex{}
+
+	d := &dispatcher{
+		key:     key,
+		limit:   limit,
+		pending: make(map[string][]string),
+		active:  make(map[string]int),
+		mu:      mu,
+		cond:    sync.NewCond(mu),
+	}
+
+	seen := make(map[string]bool, len(urls))
+
+	for _, url := range urls {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		d.total++
+
+		k := key(url)
+
+		if _, ok := d.pending[k]; !ok {
+			d.keys = append(d.keys, k)
+		}
+
+		d.pending[k] = append(d.pending[k], url)
+	}
+
+	return d
+}
+
+// next blocks until there is a url that can be downloaded without going over
+// its key's limit. ok is false once every url has been handed out or stop was
+// called. done must be called with the url once it has been downloaded
+func (d *dispatcher) next() (url string, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for {
+		if d.stopped || len(d.keys) == 0 {
+			return "", false
+		}
+
+		for range len(d.keys) {
+			i := d.cursor % len(d.keys)
+			k := d.keys[i]
+
+			if d.limit > 0 && d.active[k] >= d.limit {
+				d.cursor = i + 1
+				continue
+			}
+
+			url := d.pending[k][0]
+			d.pending[k] = d.pending[k][1:]
+			d.active[k]++
+
+			if len(d.pending[k]) == 0 {
+				delete(d.pending, k)
+				d.keys = slices.Delete(d.keys, i, i+1)
+
+				// whoever was after k has moved into its spot
+				d.cursor = i
+			} else {
+				d.cursor = i + 1
+			}
+
+			return url, true
+		}
+
+		// every key with urls left is at its limit
+		d.cond.Wait()
+	}
+}
+
+func (d *dispatcher) done(url string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := d.key(url)
+
+	d.active[k]--
+	if d.active[k] == 0 {
+		delete(d.active, k)
+	}
+
+	d.cond.Broadcast()
+}
+
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopped = true
+
+	d.cond.Broadcast()
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadAll_KeyLimit(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var mu sync.Mutex
+		inFlight := make(map[string]int)
+		peak := make(map[string]int)
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			host := HostKey(url)
+
+			mu.Lock()
+			inFlight[host]++
+			peak[host] = max(peak[host], inFlight[host])
+			mu.Unlock()
+
+			time.Sleep(100 * time.Millisecond)
+
+			mu.Lock()
+			inFlight[host]--
+			mu.Unlock()
+
+			return 1, nil
+		})
+
+		// most urls are on one host, which must not hold up the others
+		var urls []string
+		for i := range 8 {
+			urls = append(urls, fmt.Sprintf("https://busy.example.com/%d", i))
+		}
+		urls = append(urls, "https://a.example.com/1", "https://b.example.com/1")
+
+		d := New(f, WithMaxWorkers(4), WithKeyLimit(HostKey, 2))
+
+		start := time.Now()
+		finished := make(map[string]time.Duration)
+
+		for url, result := range d.Stream(t.Context(), urls) {
+			assert.NoError(t, result.Err)
+			finished[url] = time.Since(start)
+		}
+
+		assert.Equal(t, map[string]int{
+			"busy.example.com": 2,
+			"a.example.com":    1,
+			"b.example.com":    1,
+		}, peak)
+
+		assert.Equal(t, 100*time.Millisecond, finished["https://a.example.com/1"])
+		assert.Equal(t, 100*time.Millisecond, finished["https://b.example.com/1"])
+		// 8 urls 2 at a time
+		assert.Equal(t, 400*time.Millisecond, time.Since(start))
+	})
+}
+
+func TestHostKey(t *testing.T) {
+	testCases := []struct {
+		url      string
+		expected string
+	}{
+		{url: "https://example.com/a/b", expected: "example.com"},
+		{url: "http://example.com:8080/a", expected: "example.com:8080"},
+		{url: "url_1", expected: "url_1"},
+		{url: "://bad", expected: "://bad"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			assert.Equal(t, tc.expected, HostKey(tc.url))
+		})
+	}
+}
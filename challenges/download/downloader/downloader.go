@@ -0,0 +1,259 @@
+// Package downloader downloads many urls concurrently, keeping a result for
+// every url so a single failure doesn't throw away everything else
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+)
+
+// Fetcher downloads the data behind a single url
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (int, error)
+}
+
+// FetcherFunc lets a plain function be used as a Fetcher
+type FetcherFunc func(ctx context.Context, url string) (int, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, url string) (int, error) {
+	return f(ctx, url)
+}
+
+// Result is the outcome of downloading a single url
+type Result struct {
+	URL      string
+	Value    int
+	Err      error
+	Duration time.Duration
+	Attempts int
+	// Hedged is true if any attempt had a hedge racing it
+	Hedged bool
+	// Resumed is true when the result came from a checkpoint of an earlier run
+	Resumed bool
+	// Cached is true when the result came from the cache rather than a fetch
+	Cached bool
+}
+
+// Report holds the result of every url along with totals across all of them
+type Report struct {
+	Results   map[string]Result
+	Sum       int
+	Succeeded int
+	Failed    int
+	Duration  time.Duration
+}
+
+// Err joins the errors of every url that failed, nil if none did
+func (r Report) Err() error {
+	var errs []error
+
+	for url, result := range r.Results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, result.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+type Option func(*Downloader)
+
+// WithMaxWorkers caps how many urls are downloaded at the same time, anything
+// below 1 means no cap
+func WithMaxWorkers(n int) Option {
+	return func(d *Downloader) {
+		d.maxWorkers = n
+	}
+}
+
+type Downloader struct {
+	fetcher    Fetcher
+	maxWorkers int
+	retry      RetryPolicy
+	key        func(url string) string
+	keyLimit   int
+	limiter    Limiter
+	cache      *cache
+	flights    *flights
+	progress   func(Progress)
+	hedger     *hedger
+	checkpoint *Checkpoint
+}
+
+func New(fetcher Fetcher, opts ...Option) *Downloader {
+	d := &Downloader{
+		fetcher:    fetcher,
+		maxWorkers: 10,
+		limiter:    noLimit{},
+		flights:    newFlights(),
+	}
+
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// DownloadAll downloads every url and reports how each one went. A url failing
+// doesn't stop the others, check Report.Err or the individual results for that.
+// A url that appears more than once is only downloaded and counted once
+func (d *Downloader) DownloadAll(ctx context.Context, urls []string) Report {
+	start := time.Now()
+
+	report := Report{
+		Results: make(map[string]Result, len(urls)),
+	}
+
+	for url, result := range d.Stream(ctx, urls) {
+		report.Results[url] = result
+
+		if result.Err != nil {
+			report.Failed++
+			continue
+		}
+
+		report.Succeeded++
+		report.Sum += result.Value
+	}
+
+	report.Duration = time.Since(start)
+
+	return report
+}
+
+// Stream downloads every url and yields each result as soon as it is ready,
+// so they come out in the order they finish rather than the order of urls.
+// Duplicate urls are skipped so each one is only yielded once. With a
+// checkpoint the results it already has are yielded first.
+// A worker holds on to its slot until its result has been consumed, so a slow
+// consumer slows the downloads down instead of results piling up. Breaking out
+// of the loop cancels whatever is still in flight
+func (d *Downloader) Stream(ctx context.Context, urls []string) iter.Seq2[string, Result] {
+	return func(yield func(string, Result) bool) {
+		// urls is left alone so ranging over the iterator again starts over
+		todo := urls
+
+		if d.checkpoint != nil {
+			var resumed []Result
+			resumed, todo = d.checkpoint.split(urls)
+
+			for _, result := range resumed {
+				if !yield(result.URL, result) {
+					return
+				}
+			}
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// closed when the consumer stops early, unlike ctx being cancelled by
+		// the caller which still gets a result for every url
+		stop := make(chan struct{})
+
+		results := make(chan Result)
+
+		dispatcher := newDispatcher(todo, d.key, d.keyLimit)
+
+		ctx = d.hedger.withHedgeBudget(ctx)
+
+		tracker := newProgressTracker(d.progress, dispatcher.total)
+		if tracker != nil {
+			ctx = context.WithValue(ctx, progressKey{}, tracker)
+		}
+
+		go func() {
+			defer close(results)
+
+			workers := len(todo)
+			if d.maxWorkers > 0 {
+				workers = min(d.maxWorkers, workers)
+			}
+
+			var wg sync.WaitGroup
+
+			for range workers {
+				wg.Go(func() {
+					for {
+						url, ok := dispatcher.next()
+						if !ok {
+							return
+						}
+
+						tracker.started()
+
+						result := d.download(ctx, url)
+
+						tracker.finished(result.Err)
+
+						if d.checkpoint != nil {
+							d.checkpoint.record(result)
+						}
+
+						// free up the key before waiting on the consumer
+						dispatcher.done(url)
+
+						select {
+						case <-stop:
+							return
+						case results <- result:
+						}
+					}
+				})
+			}
+
+			wg.Wait()
+		}()
+
+		for result := range results {
+			if !yield(result.URL, result) {
+				close(stop)
+				dispatcher.stop()
+				cancel()
+
+				// don't return until every worker is gone
+				for range results {
+				}
+
+				return
+			}
+		}
+	}
+}
+
+// fetch downloads url, waiting on the rate limiter and retrying as configured
+func (d *Downloader) fetch(ctx context.Context, url string) Result {
+	start := time.Now()
+
+	result := Result{
+		URL: url,
+	}
+
+	for {
+		err := d.limiter.Wait(ctx)
+		if err != nil {
+			result.Err = fmt.Errorf("waiting for rate limiter: %w", err)
+			break
+		}
+
+		result.Attempts++
+
+		var hedged bool
+
+		result.Value, hedged, result.Err = d.fetchOnce(ctx, url)
+		result.Hedged = result.Hedged || hedged
+
+		if result.Err == nil || !d.retry.wait(ctx, result.Attempts, result.Err) {
+			break
+		}
+	}
+
+	result.Duration = time.Since(start)
+
+	return result
+}
@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func urls(n int) []string {
+	urls := make([]string, 0, n)
+	for i := range n {
+		urls = append(urls, fmt.Sprintf("url_%d", i))
+	}
+
+	return urls
+}
+
+func TestDownloadAll(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		errBroken := errors.New("broken")
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			time.Sleep(100 * time.Millisecond)
+
+			if url == "url_3" {
+				return 0, errBroken
+			}
+
+			return 1, nil
+		})
+
+		report := New(f).DownloadAll(t.Context(), urls(10))
+
+		// one bad url doesn't throw away the rest
+		assert.Len(t, report.Results, 10)
+		assert.Equal(t, 9, report.Succeeded)
+		assert.Equal(t, 1, report.Failed)
+		assert.Equal(t, 9, report.Sum)
+		assert.ErrorIs(t, report.Err(), errBroken)
+
+		result := report.Results["url_3"]
+		assert.ErrorIs(t, result.Err, errBroken)
+		assert.Equal(t, 1, result.Attempts)
+
+		result = report.Results["url_4"]
+		assert.NoError(t, result.Err)
+		assert.Equal(t, 1, result.Value)
+		assert.Equal(t, 100*time.Millisecond, result.Duration)
+	})
+}
+
+func TestDownloadAll_MaxWorkers(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var inFlight, peak atomic.Int32
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			return 1, nil
+		})
+
+		report := New(f, WithMaxWorkers(3)).DownloadAll(t.Context(), urls(10))
+
+		assert.NoError(t, report.Err())
+		assert.Equal(t, int32(3), peak.Load())
+		// 10 urls 3 at a time takes 4 rounds
+		assert.Equal(t, 400*time.Millisecond, report.Duration)
+	})
+}
+
+func TestStream(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		delays := map[string]time.Duration{
+			"slow":   300 * time.Millisecond,
+			"fast":   100 * time.Millisecond,
+			"medium": 200 * time.Millisecond,
+		}
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			time.Sleep(delays[url])
+			return 1, nil
+		})
+
+		start := time.Now()
+
+		var order []string
+		for url, result := range New(f).Stream(t.Context(), []string{"slow", "fast", "medium"}) {
+			// each result shows up as soon as it is done
+			assert.Equal(t, delays[url], time.Since(start))
+			assert.NoError(t, result.Err)
+
+			order = append(order, url)
+		}
+
+		assert.Equal(t, []string{"fast", "medium", "slow"}, order)
+	})
+}
+
+func TestStream_Break(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var fetched, cancelled atomic.Int32
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			fetched.Add(1)
+
+			delay := time.Second
+			if url == "url_0" {
+				delay = 100 * time.Millisecond
+			}
+
+			select {
+			case <-ctx.Done():
+				cancelled.Add(1)
+				return 0, ctx.Err()
+			case <-time.After(delay):
+				return 1, nil
+			}
+		})
+
+		for url := range New(f, WithMaxWorkers(3)).Stream(t.Context(), urls(100)) {
+			assert.Equal(t, "url_0", url)
+			break
+		}
+
+		// at most the slot freed by url_0 was handed out before we broke, and
+		// everything still in flight was cancelled. synctest also fails the
+		// test if any goroutines were left behind
+		assert.LessOrEqual(t, fetched.Load(), int32(4))
+		assert.Equal(t, fetched.Load()-1, cancelled.Load())
+	})
+}
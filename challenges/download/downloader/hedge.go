@@ -0,0 +1,193 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HedgePolicy decides when a slow fetch gets a duplicate racing it. Once a
+// fetch has taken longer than Percentile of recent fetches a second one is
+// started and whichever succeeds first wins, the other is cancelled
+type HedgePolicy struct {
+	// Percentile of recent fetch latencies to wait before hedging, between 0
+	// and 100, e.g. 95
+	Percentile float64
+	// MinSamples is how many fetches have to succeed before there is enough
+	// to go on, nothing is hedged until then. 10 when 0 or less
+	MinSamples int
+	// MaxHedges caps how many hedges a single DownloadAll or Stream call can
+	// send, anything below 1 means no cap
+	MaxHedges int
+}
+
+// WithHedging hedges slow fetches according to p. Hedges wait on the rate
+// limiter like any other fetch
+func WithHedging(p HedgePolicy) Option {
+	return func(d *Downloader) {
+		if p.MinSamples <= 0 {
+			p.MinSamples = 10
+		}
+
+		d.hedger = newHedger(p)
+	}
+}
+
+// latencyWindow is how many recent latencies the percentile is taken over
+const latencyWindow = 128
+
+type hedger struct {
+	policy HedgePolicy
+
+	latencies []time.Duration // ring of the most recent latencies
+	next      int
+	mu        *sync.Mutex
+}
+
+func newHedger(p HedgePolicy) *hedger {
+	return &hedger{
+		policy:    p,
+		latencies: make([]time.Duration, 0, latencyWindow),
+		mu:        &sync.Mutex{},
+	}
+}
+
+func (h *hedger) record(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.latencies) < latencyWindow {
+		h.latencies = append(h.latencies, latency)
+		return
+	}
+
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % latencyWindow
+}
+
+// delay returns how long to wait before hedging, ok is false if there aren't
+// enough samples yet
+func (h *hedger) delay() (time.Duration, bool) {
+	h.mu.Lock()
+	sorted := slices.Clone(h.latencies)
+	h.mu.Unlock()
+
+	if len(sorted) < h.policy.MinSamples {
+		return 0, false
+	}
+
+	slices.Sort(sorted)
+
+	i := int(float64(len(sorted)-1) * min(max(h.policy.Percentile, 0), 100) / 100)
+
+	return sorted[i], true
+}
+
+type hedgeBudgetKey struct{}
+
+// withHedgeBudget gives the calls under ctx their own count of hedges sent
+func (h *hedger) withHedgeBudget(ctx context.Context) context.Context {
+	if h == nil || h.policy.MaxHedges < 1 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, hedgeBudgetKey{}, &atomic.Int64{})
+}
+
+// spend takes a hedge out of the budget for ctx, false if there are none left
+func (h *hedger) spend(ctx context.Context) bool {
+	sent, ok := ctx.Value(hedgeBudgetKey{}).(*atomic.Int64)
+	if !ok {
+		return true
+	}
+
+	return sent.Add(1) <= int64(h.policy.MaxHedges)
+}
+
+type fetchResult struct {
+	value int
+	err   error
+}
+
+// fetchOnce makes a single attempt at url, hedging it if it is slow. hedged
+// is true if a hedge was sent, whether or not it won
+func (d *Downloader) fetchOnce(ctx context.Context, url string) (value int, hedged bool, err error) {
+	if d.hedger == nil {
+		value, err = d.fetcher.Fetch(ctx, url)
+		return value, false, err
+	}
+
+	start := time.Now()
+
+	delay, ok := d.hedger.delay()
+	if !ok {
+		value, err = d.fetcher.Fetch(ctx, url)
+		if err == nil {
+			d.hedger.record(time.Since(start))
+		}
+
+		return value, false, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// room for both so the loser never blocks on its way out
+	results := make(chan fetchResult, 2)
+	outstanding := 0
+
+	launch := func(wait bool) {
+		outstanding++
+
+		go func() {
+			if wait {
+				err := d.limiter.Wait(ctx)
+				if err != nil {
+					results <- fetchResult{err: fmt.Errorf("waiting for rate limiter: %w", err)}
+					return
+				}
+			}
+
+			value, err := d.fetcher.Fetch(ctx, url)
+			results <- fetchResult{value: value, err: err}
+		}()
+	}
+
+	defer func() {
+		// cancel the loser and wait for it so nothing outlives the call
+		cancel()
+		for range outstanding {
+			<-results
+		}
+	}()
+
+	launch(false)
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if d.hedger.spend(ctx) {
+				hedged = true
+				launch(true)
+			}
+		case r := <-results:
+			outstanding--
+
+			// if one fails the other might still succeed
+			if r.err != nil && outstanding > 0 {
+				continue
+			}
+
+			if r.err == nil {
+				d.hedger.record(time.Since(start))
+			}
+
+			return r.value, hedged, r.err
+		}
+	}
+}
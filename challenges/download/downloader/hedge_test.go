@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowFirst takes 100ms for every fetch except those of urls starting with
+// fast, which take 50ms, and the first fetch of a url starting with slow, which
+// takes a minute unless it is cancelled
+func slowFirst(cancelled *atomic.Int32) Fetcher {
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+
+	return FetcherFunc(func(ctx context.Context, url string) (int, error) {
+		mu.Lock()
+		first := !seen[url]
+		seen[url] = true
+		mu.Unlock()
+
+		delay := 100 * time.Millisecond
+		if strings.HasPrefix(url, "fast") {
+			delay = 50 * time.Millisecond
+		}
+
+		if first && strings.HasPrefix(url, "slow") {
+			delay = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			cancelled.Add(1)
+			return 0, ctx.Err()
+		case <-time.After(delay):
+			return 1, nil
+		}
+	})
+}
+
+func TestDownloadAll_Hedging(t *testing.T) {
+	testCases := []struct {
+		desc            string
+		policy          HedgePolicy
+		warmup          int
+		urls            []string
+		expectedHedged  []string
+		expectedMaxTime time.Duration
+	}{
+		{
+			desc:            "slow fetch is hedged",
+			policy:          HedgePolicy{Percentile: 95},
+			warmup:          10,
+			urls:            []string{"slow_0", "fast"},
+			expectedHedged:  []string{"slow_0"},
+			expectedMaxTime: 200 * time.Millisecond,
+		},
+		{
+			desc:            "nothing is hedged without enough samples",
+			policy:          HedgePolicy{Percentile: 95},
+			warmup:          5,
+			urls:            []string{"slow_0", "fast"},
+			expectedMaxTime: time.Minute,
+		},
+		{
+			desc:            "hedges are capped",
+			policy:          HedgePolicy{Percentile: 95, MaxHedges: 1},
+			warmup:          10,
+			urls:            []string{"slow_0", "slow_1"},
+			expectedHedged:  []string{"slow_0"},
+			expectedMaxTime: time.Minute,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				var cancelled atomic.Int32
+
+				d := New(slowFirst(&cancelled), WithMaxWorkers(1), WithHedging(tC.policy))
+
+				report := d.DownloadAll(t.Context(), urls(tC.warmup))
+				require.NoError(t, report.Err())
+
+				report = d.DownloadAll(t.Context(), tC.urls)
+				require.NoError(t, report.Err())
+
+				var hedged []string
+				var slowest time.Duration
+
+				for url, result := range report.Results {
+					if result.Hedged {
+						hedged = append(hedged, url)
+					}
+
+					slowest = max(slowest, result.Duration)
+				}
+
+				// with a single worker the hedged url has to be the first one
+				// so only it gets the single hedge
+				assert.Equal(t, tC.expectedHedged, hedged)
+				assert.Equal(t, tC.expectedMaxTime, slowest)
+
+				// every hedge that won cancelled the slow original
+				assert.Equal(t, int32(len(hedged)), cancelled.Load())
+			})
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxBodySize is how big a body HTTPFetcher reads when MaxBodySize isn't set
+const DefaultMaxBodySize = 1 << 20
+
+// ErrBodyTooLarge is returned when a response body is bigger than the fetcher
+// allows. It isn't retryable since the same url will just be too big again
+var ErrBodyTooLarge = Permanent(errors.New("response body too large"))
+
+// StatusError is returned for any response that isn't a 2xx
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Retryable reports whether the status is one the server might answer
+// differently next time: 408, 429 and any 5xx
+func (e StatusError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusRequestTimeout,
+		e.StatusCode == http.StatusTooManyRequests,
+		e.StatusCode >= 500:
+		return true
+	default:
+		return false
+	}
+}
+
+// HTTPFetcher fetches urls with a GET and parses the body as an integer. The
+// zero value is ready to use
+type HTTPFetcher struct {
+	// Client is used to make requests, http.DefaultClient when nil
+	Client *http.Client
+	// MaxBodySize caps how many bytes of a body are read, DefaultMaxBodySize
+	// when 0 or less
+	MaxBodySize int64
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, Permanent(fmt.Errorf("creating request: %w", err))
+	}
+
+	client := f.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("doing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	maxSize := f.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// read a little of what is left so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+		return 0, StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if resp.ContentLength > maxSize {
+		return 0, ErrBodyTooLarge
+	}
+
+	// read one byte past the limit to tell a body that fits exactly from one
+	// that doesn't, without ever holding more than that in memory
+	body, err := io.ReadAll(countingReader{ctx: ctx, r: io.LimitReader(resp.Body, maxSize+1)})
+	if err != nil {
+		return 0, fmt.Errorf("reading body: %w", err)
+	}
+
+	if int64(len(body)) > maxSize {
+		return 0, ErrBodyTooLarge
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, Permanent(fmt.Errorf("parsing body: %w", err))
+	}
+
+	return n, nil
+}
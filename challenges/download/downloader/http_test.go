@@ -0,0 +1,210 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		handler           http.HandlerFunc
+		maxBodySize       int64
+		expected          int
+		expectedErr       error
+		expectedRetryable bool
+	}{
+		{
+			desc: "parses the body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, 42)
+			},
+			expected: 42,
+		},
+		{
+			desc: "server error is retryable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			expectedErr:       StatusError{StatusCode: http.StatusServiceUnavailable},
+			expectedRetryable: true,
+		},
+		{
+			desc: "too many requests is retryable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+			expectedErr:       StatusError{StatusCode: http.StatusTooManyRequests},
+			expectedRetryable: true,
+		},
+		{
+			desc: "not found isn't retryable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			expectedErr: StatusError{StatusCode: http.StatusNotFound},
+		},
+		{
+			desc: "body that isn't a number isn't retryable",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "nope")
+			},
+			expectedErr: strconv.ErrSyntax,
+		},
+		{
+			desc: "body over the limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, 123456)
+			},
+			maxBodySize: 5,
+			expectedErr: ErrBodyTooLarge,
+		},
+		{
+			desc: "streamed body over the limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// flushing first means there is no content length to go on
+				w.(http.Flusher).Flush()
+				fmt.Fprint(w, strings.Repeat("1", 100))
+			},
+			maxBodySize: 10,
+			expectedErr: ErrBodyTooLarge,
+		},
+		{
+			desc: "body exactly at the limit",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, 12345)
+			},
+			maxBodySize: 5,
+			expected:    12345,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			server := httptest.NewServer(tC.handler)
+			defer server.Close()
+
+			f := &HTTPFetcher{Client: server.Client(), MaxBodySize: tC.maxBodySize}
+
+			n, err := f.Fetch(t.Context(), server.URL)
+			if tC.expectedErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, tC.expected, n)
+				return
+			}
+
+			assert.ErrorIs(t, err, tC.expectedErr)
+			assert.Equal(t, tC.expectedRetryable, IsRetryable(err))
+		})
+	}
+}
+
+// slow returns a handler that answers 1 after delay, or gives up when the
+// client goes away
+func slow(delay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(delay):
+			fmt.Fprint(w, 1)
+		}
+	}
+}
+
+func TestHTTPFetcher_Timeout(t *testing.T) {
+	server := httptest.NewServer(slow(time.Minute))
+	defer server.Close()
+
+	f := &HTTPFetcher{Client: server.Client()}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := f.Fetch(ctx, server.URL)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestHTTPFetcher_Cancel(t *testing.T) {
+	server := httptest.NewServer(slow(time.Minute))
+	defer server.Close()
+
+	f := &HTTPFetcher{Client: server.Client()}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+
+	_, err := f.Fetch(ctx, server.URL)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestDownloadAll_HTTP(t *testing.T) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			// fails the first time through
+			if requests.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			fmt.Fprint(w, 2)
+		case "/slow":
+			slow(time.Minute)(w, r)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, 1)
+		}
+	}))
+	defer server.Close()
+
+	f := &HTTPFetcher{Client: server.Client()}
+
+	d := New(f, WithRetry(RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	}))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	report := d.DownloadAll(ctx, []string{
+		server.URL + "/ok",
+		server.URL + "/flaky",
+		server.URL + "/slow",
+		server.URL + "/missing",
+	})
+
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 3, report.Sum)
+
+	result := report.Results[server.URL+"/flaky"]
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 2, result.Attempts)
+
+	result = report.Results[server.URL+"/slow"]
+	assert.ErrorIs(t, result.Err, context.DeadlineExceeded)
+	assert.Equal(t, 1, result.Attempts)
+
+	// not found is permanent so it only gets the one attempt
+	result = report.Results[server.URL+"/missing"]
+	assert.ErrorIs(t, result.Err, StatusError{StatusCode: http.StatusNotFound})
+	assert.Equal(t, 1, result.Attempts)
+}
@@ -0,0 +1,60 @@
+package downloader
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter hands out permits to fetch, blocking until one is available or ctx
+// is done. The limiters in challenges/rate-limiter satisfy this
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// WithRateLimiter makes every fetch, retries included, wait for a permit from
+// l first
+func WithRateLimiter(l Limiter) Option {
+	return func(d *Downloader) {
+		d.limiter = l
+	}
+}
+
+// Allower is a limiter that can only say whether a fetch may happen right now
+type Allower interface {
+	Allow(ctx context.Context) bool
+}
+
+// PollLimiter turns an Allower into a Limiter by asking it again every
+// interval until it says yes
+func PollLimiter(l Allower, interval time.Duration) Limiter {
+	return pollLimiter{
+		limiter:  l,
+		interval: interval,
+	}
+}
+
+type pollLimiter struct {
+	limiter  Allower
+	interval time.Duration
+}
+
+func (p pollLimiter) Wait(ctx context.Context) error {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for !p.limiter.Allow(ctx) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+
+	return nil
+}
+
+type noLimit struct{}
+
+func (noLimit) Wait(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package downloader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tickLimiter allows one fetch every interval
+type tickLimiter struct {
+	interval time.Duration
+	next     time.Time
+	mu       sync.Mutex
+}
+
+func (l *tickLimiter) Allow(ctx context.Context) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.next) {
+		return false
+	}
+
+	l.next = now.Add(l.interval)
+
+	return true
+}
+
+func TestDownloadAll_RateLimiter(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var mu sync.Mutex
+		var starts []time.Duration
+
+		start := time.Now()
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			mu.Lock()
+			starts = append(starts, time.Since(start))
+			mu.Unlock()
+
+			return 1, nil
+		})
+
+		l := PollLimiter(&tickLimiter{interval: 100 * time.Millisecond}, 10*time.Millisecond)
+
+		report := New(f, WithRateLimiter(l)).DownloadAll(t.Context(), urls(5))
+		assert.NoError(t, report.Err())
+
+		// plenty of workers but only one fetch every 100ms
+		assert.Equal(t, []time.Duration{
+			0,
+			100 * time.Millisecond,
+			200 * time.Millisecond,
+			300 * time.Millisecond,
+			400 * time.Millisecond,
+		}, starts)
+	})
+}
+
+func TestDownloadAll_RateLimiterCancelled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			return 1, nil
+		})
+
+		l := PollLimiter(&tickLimiter{interval: time.Hour}, time.Second)
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Minute)
+		defer cancel()
+
+		report := New(f, WithRateLimiter(l)).DownloadAll(ctx, urls(3))
+
+		assert.Equal(t, 1, report.Succeeded)
+		assert.Equal(t, 2, report.Failed)
+		assert.ErrorIs(t, report.Err(), context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of how far along a download is
+type Progress struct {
+	// Total is how many distinct urls are being downloaded
+	Total     int
+	Completed int
+	Failed    int
+	InFlight  int
+	// Bytes is how many bytes fetchers have reported with AddBytes
+	Bytes   int64
+	Elapsed time.Duration
+	// ETA is how much longer the rest should take going by how fast urls have
+	// finished so far, 0 until the first one does
+	ETA time.Duration
+}
+
+// Done is how many urls have finished, whether they succeeded or not
+func (p Progress) Done() int {
+	return p.Completed + p.Failed
+}
+
+// WithProgress calls fn with a fresh snapshot every time a url starts or
+// finishes or bytes are reported. Calls never overlap but they do happen on
+// the download's goroutines, so fn should be quick
+func WithProgress(fn func(Progress)) Option {
+	return func(d *Downloader) {
+		d.progress = fn
+	}
+}
+
+// AddBytes reports n more bytes downloaded by the fetch running under ctx.
+// Fetchers call it as they read so progress can include bytes, it does
+// nothing if no one is tracking progress
+func AddBytes(ctx context.Context, n int64) {
+	t, _ := ctx.Value(progressKey{}).(*progressTracker)
+	t.addBytes(n)
+}
+
+type progressKey struct{}
+
+// progressTracker keeps the counts behind Progress for a single call. A nil
+// tracker ignores everything so callers don't have to check
+type progressTracker struct {
+	fn       func(Progress)
+	start    time.Time
+	progress Progress
+	mu       *sync.Mutex
+}
+
+func newProgressTracker(fn func(Progress), total int) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+
+	return &progressTracker{
+		fn:       fn,
+		start:    time.Now(),
+		progress: Progress{Total: total},
+		mu:       &sync.Mutex{},
+	}
+}
+
+func (t *progressTracker) started() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress.InFlight++
+	t.report()
+}
+
+func (t *progressTracker) finished(err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress.InFlight--
+
+	if err != nil {
+		t.progress.Failed++
+	} else {
+		t.progress.Completed++
+	}
+
+	t.report()
+}
+
+func (t *progressTracker) addBytes(n int64) {
+	if t == nil || n == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress.Bytes += n
+	t.report()
+}
+
+// report hands a snapshot to fn, t.mu must be held so snapshots arrive in order
+func (t *progressTracker) report() {
+	t.progress.Elapsed = time.Since(t.start)
+
+	t.progress.ETA = 0
+	if done := t.progress.Done(); done > 0 {
+		perURL := t.progress.Elapsed / time.Duration(done)
+		t.progress.ETA = perURL * time.Duration(t.progress.Total-done)
+	}
+
+	t.fn(t.progress)
+}
+
+// countingReader reports everything read through it with AddBytes
+type countingReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	AddBytes(c.ctx, int64(n))
+	return n, err
+}
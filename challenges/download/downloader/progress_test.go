@@ -0,0 +1,83 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadAll_Progress(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		errBroken := errors.New("broken")
+
+		f := FetcherFunc(func(ctx context.Context, url string) (int, error) {
+			time.Sleep(100 * time.Millisecond)
+			AddBytes(ctx, 10)
+
+			if url == "url_3" {
+				return 0, errBroken
+			}
+
+			return 1, nil
+		})
+
+		var snapshots []Progress
+
+		d := New(f, WithMaxWorkers(2), WithProgress(func(p Progress) {
+			snapshots = append(snapshots, p)
+		}))
+
+		// the duplicate isn't counted
+		d.DownloadAll(t.Context(), append(urls(4), "url_0"))
+
+		require.NotEmpty(t, snapshots)
+
+		for _, p := range snapshots {
+			assert.Equal(t, 4, p.Total)
+			assert.LessOrEqual(t, p.InFlight, 2)
+		}
+
+		assert.Equal(t, Progress{
+			Total:     4,
+			Completed: 3,
+			Failed:    1,
+			Bytes:     40,
+			Elapsed:   200 * time.Millisecond,
+		}, snapshots[len(snapshots)-1])
+
+		// two urls took 100ms so the other two should take about as long
+		for _, p := range snapshots {
+			if p.Done() == 2 {
+				assert.Equal(t, 100*time.Millisecond, p.ETA)
+				break
+			}
+		}
+	})
+}
+
+func TestHTTPFetcher_Progress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, 12345)
+	}))
+	defer server.Close()
+
+	var last Progress
+
+	d := New(&HTTPFetcher{Client: server.Client()}, WithProgress(func(p Progress) {
+		last = p
+	}))
+
+	report := d.DownloadAll(t.Context(), []string{server.URL + "/a", server.URL + "/b"})
+	require.NoError(t, report.Err())
+
+	assert.Equal(t, 2, last.Completed)
+	assert.Equal(t, int64(10), last.Bytes)
+}
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed fetch is tried again. Delays
+// grow exponentially from BaseDelay up to MaxDelay with full jitter, so each
+// wait is a random duration between 0 and the current delay
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, anything below 2 means no retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	// MaxDelay caps how long a single wait can be, 0 or less means no cap
+	MaxDelay time.Duration
+	// Retryable reports whether err is worth another attempt, IsRetryable is
+	// used when it is nil
+	Retryable func(err error) bool
+}
+
+// WithRetry retries failed fetches according to p
+func WithRetry(p RetryPolicy) Option {
+	return func(d *Downloader) {
+		if p.Retryable == nil {
+			p.Retryable = IsRetryable
+		}
+
+		d.retry = p
+	}
+}
+
+// IsRetryable is the default retry classifier. Context errors aren't retried
+// and neither is any error that has a Retryable() bool method returning false,
+// such as one wrapped with Permanent. Everything else is
+func IsRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	return true
+}
+
+// Permanent marks err as not worth retrying
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+func (e permanentError) Retryable() bool {
+	return false
+}
+
+// wait sleeps before the next attempt after attempt failed with err. It
+// returns false if there shouldn't be another attempt, either because the
+// policy says so or because ctx would be done before it could happen
+func (p RetryPolicy) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt >= p.MaxAttempts || !p.Retryable(err) {
+		return false
+	}
+
+	delay := p.backoff(attempt)
+
+	deadline, ok := ctx.Deadline()
+	if ok && time.Until(deadline) < delay {
+		// no point sleeping just to be cancelled
+		return false
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// backoff picks the delay after the given number of failed attempts
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		// no cap other than what fits in a Duration
+		maxDelay = math.MaxInt64
+	}
+
+	delay := maxDelay
+
+	// stop shifting before it can overflow
+	shift := attempt - 1
+	if shift < 63 && p.BaseDelay <= maxDelay>>shift {
+		delay = p.BaseDelay << shift
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return rand.N(min(delay, math.MaxInt64-1) + 1)
+}
@@ -0,0 +1,171 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flaky fails the first n attempts at every url with err
+func flaky(n int32, err error) Fetcher {
+	var attempts atomic.Int32
+
+	return FetcherFunc(func(ctx context.Context, url string) (int, error) {
+		if attempts.Add(1) <= n {
+			return 0, err
+		}
+
+		return 1, nil
+	})
+}
+
+func TestDownloadAll_Retry(t *testing.T) {
+	errFlaky := errors.New("flaky")
+
+	testCases := []struct {
+		desc             string
+		fetcher          Fetcher
+		policy           RetryPolicy
+		timeout          time.Duration
+		expectedErr      error
+		expectedAttempts int
+	}{
+		{
+			desc:             "no retries by default",
+			fetcher:          flaky(1, errFlaky),
+			expectedErr:      errFlaky,
+			expectedAttempts: 1,
+		},
+		{
+			desc:    "succeeds after retrying",
+			fetcher: flaky(2, errFlaky),
+			policy: RetryPolicy{
+				MaxAttempts: 5,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    time.Second,
+			},
+			expectedAttempts: 3,
+		},
+		{
+			desc:    "gives up after max attempts",
+			fetcher: flaky(10, errFlaky),
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    time.Second,
+			},
+			expectedErr:      errFlaky,
+			expectedAttempts: 3,
+		},
+		{
+			desc:    "doesn't retry permanent errors",
+			fetcher: flaky(10, Permanent(errFlaky)),
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    time.Second,
+			},
+			expectedErr:      errFlaky,
+			expectedAttempts: 1,
+		},
+		{
+			desc:    "custom classifier",
+			fetcher: flaky(10, errFlaky),
+			policy: RetryPolicy{
+				MaxAttempts: 3,
+				BaseDelay:   100 * time.Millisecond,
+				MaxDelay:    time.Second,
+				Retryable: func(err error) bool {
+					return !errors.Is(err, errFlaky)
+				},
+			},
+			expectedErr:      errFlaky,
+			expectedAttempts: 1,
+		},
+		{
+			desc:    "stops when the deadline would pass before the next attempt",
+			fetcher: flaky(10, errFlaky),
+			policy: RetryPolicy{
+				MaxAttempts: 10,
+				BaseDelay:   time.Hour,
+				MaxDelay:    time.Hour,
+			},
+			timeout:          time.Millisecond,
+			expectedErr:      errFlaky,
+			expectedAttempts: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				ctx := t.Context()
+
+				if tc.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+					defer cancel()
+				}
+
+				report := New(tc.fetcher, WithRetry(tc.policy)).DownloadAll(ctx, []string{"url"})
+
+				result := report.Results["url"]
+				assert.ErrorIs(t, result.Err, tc.expectedErr)
+				assert.Equal(t, tc.expectedAttempts, result.Attempts)
+			})
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1:   100 * time.Millisecond,
+		2:   200 * time.Millisecond,
+		3:   400 * time.Millisecond,
+		4:   800 * time.Millisecond,
+		5:   time.Second,
+		100: time.Second,
+	} {
+		for range 100 {
+			delay := p.backoff(attempt)
+
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling)
+		}
+	}
+
+	// without a max the delays keep growing rather than dropping to 0
+	p.MaxDelay = 0
+
+	for attempt, ceiling := range map[int]time.Duration{
+		1:   100 * time.Millisecond,
+		5:   1600 * time.Millisecond,
+		10:  51200 * time.Millisecond,
+		100: math.MaxInt64,
+	} {
+		var longest time.Duration
+
+		for range 100 {
+			delay := p.backoff(attempt)
+
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling)
+
+			longest = max(longest, delay)
+		}
+
+		// jitter is spread over the whole range so 100 waits all landing in
+		// the bottom half is vanishingly unlikely
+		assert.Greater(t, longest, ceiling/2)
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"log/slog"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
-	"sync"
+	"strings"
 	"time"
 
-	"golang.org/x/sync/errgroup"
+	"github.com/goconc/challenges/download/downloader"
 )
 
 func main() {
@@ -27,66 +29,57 @@ func main() {
 func run() error {
 	concurrency := 10
 
+	// stand in for the real thing so there is something to download from
+	server := httptest.NewServer(http.HandlerFunc(serve))
+	defer server.Close()
+
 	urls := make([]string, 0, 100)
 	for i := range cap(urls) {
-		urls = append(urls, fmt.Sprintf("url_%d", i))
+		urls = append(urls, fmt.Sprintf("%s/url_%d", server.URL, i))
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	start := time.Now()
-	m, err := downloadAll(ctx, urls, concurrency)
-	if err != nil {
-		return fmt.Errorf("downloading all: %w", err)
-	}
-
-	fmt.Printf("finished in %s\n", time.Since(start).String())
-
-	fmt.Println("sum", m["sum"])
+	d := downloader.New(
+		&downloader.HTTPFetcher{Client: server.Client()},
+		downloader.WithMaxWorkers(concurrency),
+		downloader.WithProgress(printProgress),
+	)
 
-	return nil
-}
+	report := d.DownloadAll(ctx, urls)
 
-func downloadAll(ctx context.Context, urls []string, maxWorkers int) (map[string]int, error) {
-	g, ctx := errgroup.WithContext(ctx)
-	g.SetLimit(maxWorkers)
+	// move off the progress line
+	fmt.Fprintln(os.Stderr)
 
-	m := make(map[string]int, len(urls))
+	fmt.Printf("finished in %s\n", report.Duration.String())
 
-	var l sync.Mutex
+	fmt.Println("sum", report.Sum)
+	fmt.Println("succeeded", report.Succeeded, "failed", report.Failed)
 
-	for _, url := range urls {
-		g.Go(func() error {
-			result, err := download(ctx, url)
-			if err != nil {
-				return fmt.Errorf("downloading file: %w", err)
-			}
+	err := report.Err()
+	if err != nil {
+		return fmt.Errorf("downloading all: %w", err)
+	}
 
-			l.Lock()
-			m[url] = result
-			m["sum"] += result
-			l.Unlock()
+	return nil
+}
 
-			return nil
-		})
-	}
+func printProgress(p downloader.Progress) {
+	const width = 30
 
-	err := g.Wait()
-	if err != nil {
-		return nil, err
-	}
+	filled := width * p.Done() / max(p.Total, 1)
 
-	return m, nil
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d failed %d in flight %d %dB eta %s   ",
+		strings.Repeat("#", filled), strings.Repeat(" ", width-filled),
+		p.Done(), p.Total, p.Failed, p.InFlight, p.Bytes, p.ETA.Round(time.Millisecond))
 }
 
-func download(ctx context.Context, url string) (int, error) {
+func serve(w http.ResponseWriter, r *http.Request) {
 	select {
-	case <-ctx.Done():
-		return 0, ctx.Err()
-	default:
+	case <-r.Context().Done():
+	case <-time.After(100 * time.Millisecond):
 		// simulate work
-		time.Sleep(100 * time.Millisecond)
-		return rand.Intn(10) + 1, nil
+		fmt.Fprint(w, rand.Intn(10)+1)
 	}
 }
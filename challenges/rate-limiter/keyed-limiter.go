@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	shardedmap "github.com/goconc/challenges/sharded-map"
+)
+
+// KeyedLimiter keeps a separate limiter for every key, e.g. one per API key,
+// created the first time the key is seen. Keys that go unused for longer than
+// the idle ttl are dropped so they don't build up forever, a key that comes
+// back after that starts over with a fresh limiter
+type KeyedLimiter struct {
+	limiters *shardedmap.ShardedMap[*keyedEntry]
+	factory  func(key string) rateLimiter
+	ttl      time.Duration
+
+	// unix nanos of the last sweep for idle keys
+	lastSweep *atomic.Int64
+}
+
+type keyedEntry struct {
+	limiter rateLimiter
+	// unix nanos of the last time the key was used
+	lastUsed *atomic.Int64
+	// how many waits are in progress, a key isn't idle while it has any
+	waiting *atomic.Int32
+}
+
+// keyedShards is how many shards the keys are spread over
+const keyedShards = 32
+
+// NewKeyedLimiter returns a KeyedLimiter that calls factory to create the
+// limiter for a key and drops keys that have been idle for ttl. A ttl of 0 or
+// less means keys are never dropped
+func NewKeyedLimiter(factory func(key string) rateLimiter, ttl time.Duration) *KeyedLimiter {
+	lastSweep := &atomic.Int64{}
+	lastSweep.Store(time.Now().UnixNano())
+
+	return &KeyedLimiter{
+		limiters:  shardedmap.NewShardedMap[*keyedEntry](keyedShards),
+		factory:   factory,
+		ttl:       ttl,
+		lastSweep: lastSweep,
+	}
+}
+
+func (k *KeyedLimiter) Allow(ctx context.Context, key string) bool {
+	return k.AllowN(ctx, key, 1)
+}
+
+func (k *KeyedLimiter) AllowN(ctx context.Context, key string, n int) bool {
+	return k.get(key).limiter.AllowN(ctx, n)
+}
+
+func (k *KeyedLimiter) Wait(ctx context.Context, key string) error {
+	return k.WaitN(ctx, key, 1)
+}
+
+func (k *KeyedLimiter) WaitN(ctx context.Context, key string, n int) error {
+	e := k.get(key)
+
+	e.waiting.Add(1)
+	defer func() {
+		e.lastUsed.Store(time.Now().UnixNano())
+		e.waiting.Add(-1)
+	}()
+
+	return e.limiter.WaitN(ctx, n)
+}
+
+func (k *KeyedLimiter) Reserve(key string) *Reservation {
+	return k.get(key).limiter.Reserve()
+}
+
+// Len returns how many keys currently have a limiter
+func (k *KeyedLimiter) Len() int {
+	return k.limiters.Len()
+}
+
+// get returns the entry for key, creating it if needed, and marks it as used.
+// Every call also checks whether it is time to sweep for idle keys
+func (k *KeyedLimiter) get(key string) *keyedEntry {
+	now := time.Now().UnixNano()
+
+	k.sweep(now)
+
+	e, _ := k.limiters.GetOrCreate(key, func() *keyedEntry {
+		return &keyedEntry{
+			limiter:  k.factory(key),
+			lastUsed: &atomic.Int64{},
+			waiting:  &atomic.Int32{},
+		}
+	})
+
+	// a sweep racing us could have dropped a key that was idle right up until
+	// now, the worst that does is let this one call use a limiter no one else
+	// will see
+	e.lastUsed.Store(now)
+
+	return e
+}
+
+// sweep drops idle keys at most once every ttl, only the caller that wins the
+// swap does the work so everyone else carries on without waiting
+func (k *KeyedLimiter) sweep(now int64) {
+	if k.ttl <= 0 {
+		return
+	}
+
+	last := k.lastSweep.Load()
+	if now-last < int64(k.ttl) || !k.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	k.limiters.DeleteFunc(func(key string, e *keyedEntry) bool {
+		return e.waiting.Load() == 0 && now-e.lastUsed.Load() >= int64(k.ttl)
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var created atomic.Int32
+
+		k := NewKeyedLimiter(func(key string) rateLimiter {
+			created.Add(1)
+			return New(2, 1)
+		}, time.Minute)
+
+		var wg sync.WaitGroup
+		var allowedA, allowedB atomic.Int32
+
+		for range 10 {
+			wg.Go(func() {
+				if k.Allow(t.Context(), "a") {
+					allowedA.Add(1)
+				}
+
+				if k.Allow(t.Context(), "b") {
+					allowedB.Add(1)
+				}
+			})
+		}
+
+		wg.Wait()
+
+		// each key gets its own bucket
+		assert.Equal(t, int32(2), allowedA.Load())
+		assert.Equal(t, int32(2), allowedB.Load())
+		assert.Equal(t, int32(2), created.Load())
+		assert.Equal(t, 2, k.Len())
+	})
+}
+
+func TestKeyedLimiter_EvictsIdleKeys(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		k := NewKeyedLimiter(func(key string) rateLimiter {
+			return NewSlidingWindowCounter(1, time.Hour)
+		}, time.Minute)
+
+		assert.True(t, k.Allow(t.Context(), "idle"))
+		assert.True(t, k.Allow(t.Context(), "busy"))
+
+		for range 4 {
+			time.Sleep(30 * time.Second)
+			assert.False(t, k.Allow(t.Context(), "busy"))
+		}
+
+		// idle was dropped so it starts over, busy never was
+		assert.Equal(t, 1, k.Len())
+		assert.True(t, k.Allow(t.Context(), "idle"))
+		assert.False(t, k.Allow(t.Context(), "busy"))
+	})
+}
+
+func TestKeyedLimiter_NoTTLNeverEvicts(t *testing.T) {
+	for _, ttl := range []time.Duration{0, -time.Minute} {
+		t.Run(ttl.String(), func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				k := NewKeyedLimiter(func(key string) rateLimiter {
+					return New(1, 0.001)
+				}, ttl)
+
+				allowed := 0
+				for range 100 {
+					if k.Allow(t.Context(), "a") {
+						allowed++
+					}
+
+					time.Sleep(time.Second)
+				}
+
+				// the same bucket the whole time so only the first gets in
+				assert.Equal(t, 1, allowed)
+				assert.Equal(t, 1, k.Len())
+			})
+		})
+	}
+}
+
+func TestKeyedLimiter_KeepsWaitingKeys(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		k := NewKeyedLimiter(func(key string) rateLimiter {
+			return New(1, 1.0/600) // a token every 10 minutes
+		}, time.Minute)
+
+		require.NoError(t, k.Wait(t.Context(), "a"))
+
+		var wg sync.WaitGroup
+
+		wg.Go(func() {
+			assert.NoError(t, k.Wait(t.Context(), "a"))
+		})
+
+		// well past the ttl while a is still waiting
+		time.Sleep(5 * time.Minute)
+		k.Allow(t.Context(), "b")
+
+		assert.Equal(t, 2, k.Len())
+
+		wg.Wait()
+
+		// the wait took the token a was owed, had a been dropped it would
+		// have a fresh full bucket now
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+
+		assert.ErrorIs(t, k.Wait(ctx, "a"), context.DeadlineExceeded)
+	})
+}
@@ -23,9 +23,25 @@ func main() {
 }
 
 type rateLimiter interface {
+	// Allow reports whether a request can go ahead right now
 	Allow(ctx context.Context) bool
+	// AllowN is Allow for a request that costs n
+	AllowN(ctx context.Context, n int) bool
+	// Wait blocks until a request can go ahead or ctx is done
+	Wait(ctx context.Context) error
+	// WaitN is Wait for a request that costs n, it fails with ErrInvalidN if
+	// n is less than 1 and ErrExceedsBurst if n is more than the limiter can
+	// ever allow at once
+	WaitN(ctx context.Context, n int) error
+	// Reserve claims the next permit, however far off it is
+	Reserve() *Reservation
 }
 
+var (
+	_ rateLimiter = (*tokenBucket)(nil)
+	_ rateLimiter = (*SlidingWindowCounter)(nil)
+)
+
 func run() error {
 	if len(os.Args) <= 1 {
 		return errors.New("requires arg")
@@ -34,7 +50,7 @@ func run() error {
 	var r rateLimiter
 	switch os.Args[1] {
 	case "token-bucket":
-		r = New(5, 1).Start()
+		r = New(5, 1)
 	default:
 		return fmt.Errorf("unknown rate limiter '%s'", os.Args[1])
 	}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrExceedsBurst is returned when asking for more at once than a limiter
+	// can ever hand out
+	ErrExceedsBurst = errors.New("exceeds burst")
+	// ErrInvalidN is returned when asking for less than 1
+	ErrInvalidN = errors.New("n must be at least 1")
+)
+
+// checkN makes sure n is something a limiter with the given burst could
+// eventually hand out
+func checkN(n, burst int) error {
+	if n < 1 {
+		return fmt.Errorf("asked for %d: %w", n, ErrInvalidN)
+	}
+
+	if n > burst {
+		return fmt.Errorf("asked for %d but burst is %d: %w", n, burst, ErrExceedsBurst)
+	}
+
+	return nil
+}
+
+// Reservation is a permit that can be used once its delay has passed
+type Reservation struct {
+	at       time.Time
+	cancel   func()
+	canceled bool
+	mu       *sync.Mutex
+}
+
+func newReservation(at time.Time, cancel func()) *Reservation {
+	return &Reservation{
+		at:     at,
+		cancel: cancel,
+		mu:     &sync.Mutex{},
+	}
+}
+
+// Delay returns how long to wait before acting on the reservation, 0 if it can
+// be acted on now
+func (r *Reservation) Delay() time.Duration {
+	return max(time.Until(r.at), 0)
+}
+
+// Cancel gives the permit back so someone else can have it. It does nothing
+// once the delay has passed since the permit is considered used by then
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.canceled || !time.Now().Before(r.at) {
+		return
+	}
+
+	r.canceled = true
+	r.cancel()
+}
+
+// wait blocks until r can be acted on or ctx is done, giving the permit back
+// in the latter case
+func wait(ctx context.Context, r *Reservation) error {
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok && deadline.Before(r.at) {
+		// no point waiting just to be cancelled
+		r.Cancel()
+		return fmt.Errorf("waiting %s would pass the deadline: %w", delay, context.DeadlineExceeded)
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
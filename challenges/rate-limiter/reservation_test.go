@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := New(2, 1)
+
+		assert.Equal(t, time.Duration(0), b.Reserve().Delay())
+		assert.Equal(t, time.Duration(0), b.Reserve().Delay())
+
+		// empty so each one waits for another refill
+		assert.Equal(t, time.Second, b.Reserve().Delay())
+
+		r := b.Reserve()
+		assert.Equal(t, 2*time.Second, r.Delay())
+
+		// giving it back means the next one takes its place
+		r.Cancel()
+		assert.Equal(t, 2*time.Second, b.Reserve().Delay())
+		assert.False(t, b.Allow(t.Context()))
+	})
+}
+
+func TestSlidingWindowCounterReserve(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		s := NewSlidingWindowCounter(2, time.Minute)
+
+		assert.Equal(t, time.Duration(0), s.Reserve().Delay())
+		assert.Equal(t, time.Duration(0), s.Reserve().Delay())
+
+		// the current window is full and all of it still counts right at the
+		// start of the next one
+		assert.Equal(t, time.Minute+1, s.Reserve().Delay())
+
+		// with one already in the next window this one has to wait for half
+		// of the previous window's weight to go
+		r := s.Reserve()
+		assert.Equal(t, time.Minute+30*time.Second+1, r.Delay())
+
+		// the next window is full so on to the one after
+		assert.Equal(t, 2*time.Minute+1, s.Reserve().Delay())
+
+		// giving it back means the next one takes its place
+		r.Cancel()
+		assert.Equal(t, time.Minute+30*time.Second+1, s.Reserve().Delay())
+		assert.False(t, s.Allow(t.Context()))
+	})
+}
+
+func TestSlidingWindowCounterReserveNever(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		s := NewSlidingWindowCounter(0, time.Minute)
+
+		// no window ever has room so it is never ready
+		r := s.Reserve()
+		assert.Greater(t, r.Delay(), 100*365*24*time.Hour)
+		r.Cancel()
+
+		// asking for more than the limit is never ready either and takes nothing
+		s = NewSlidingWindowCounter(1, time.Minute)
+		assert.Greater(t, s.reserveN(2).Delay(), 100*365*24*time.Hour)
+		assert.True(t, s.Allow(t.Context()))
+	})
+}
+
+func TestWait(t *testing.T) {
+	limiters := []struct {
+		desc string
+		new  func() rateLimiter
+	}{
+		{
+			desc: "token bucket",
+			new:  func() rateLimiter { return New(1, 1) },
+		},
+		{
+			desc: "sliding window counter",
+			new:  func() rateLimiter { return NewSlidingWindowCounter(1, time.Second) },
+		},
+	}
+	for _, l := range limiters {
+		t.Run(l.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				r := l.new()
+
+				start := time.Now()
+
+				require.NoError(t, r.Wait(t.Context()))
+				assert.Equal(t, time.Duration(0), time.Since(start))
+
+				// blocks for the next permit
+				require.NoError(t, r.Wait(t.Context()))
+				assert.Greater(t, time.Since(start), time.Duration(0))
+				assert.LessOrEqual(t, time.Since(start), 2*time.Second)
+
+				// gives up straight away when the permit comes after the deadline
+				ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond)
+				defer cancel()
+
+				waited := time.Now()
+
+				err := r.Wait(ctx)
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				assert.Equal(t, time.Duration(0), time.Since(waited))
+
+				// and the permit it gave back goes to the next caller
+				ctx, cancel = context.WithCancel(t.Context())
+				cancel()
+
+				assert.ErrorIs(t, r.Wait(ctx), context.Canceled)
+				assert.False(t, r.Allow(t.Context()))
+			})
+		})
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	limiters := []struct {
+		desc string
+		new  func() rateLimiter
+	}{
+		{
+			desc: "token bucket",
+			new:  func() rateLimiter { return New(10, 1) },
+		},
+		{
+			desc: "sliding window counter",
+			new:  func() rateLimiter { return NewSlidingWindowCounter(10, time.Minute) },
+		},
+	}
+	for _, l := range limiters {
+		t.Run(l.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				r := l.new()
+
+				// nothing to ask for, and asking for less mustn't make room
+				assert.False(t, r.AllowN(t.Context(), 0))
+				assert.False(t, r.AllowN(t.Context(), -100))
+
+				assert.True(t, r.AllowN(t.Context(), 7))
+
+				// only 3 left
+				assert.False(t, r.AllowN(t.Context(), 4))
+				assert.True(t, r.AllowN(t.Context(), 3))
+				assert.False(t, r.Allow(t.Context()))
+
+				// can never be allowed
+				assert.False(t, r.AllowN(t.Context(), 11))
+			})
+		})
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	limiters := []struct {
+		desc     string
+		new      func() rateLimiter
+		expected time.Duration
+	}{
+		{
+			desc:     "token bucket",
+			new:      func() rateLimiter { return New(10, 1) },
+			expected: 5 * time.Second,
+		},
+		{
+			desc: "sliding window counter",
+			new:  func() rateLimiter { return NewSlidingWindowCounter(10, time.Minute) },
+			// the full window weighs 10 at the start of the next one and has
+			// to drop below 6 for the last of 5 more to start under the limit
+			expected: time.Minute + 24*time.Second + 1,
+		},
+	}
+	for _, l := range limiters {
+		t.Run(l.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				r := l.new()
+
+				start := time.Now()
+
+				require.NoError(t, r.WaitN(t.Context(), 10))
+				require.NoError(t, r.WaitN(t.Context(), 5))
+
+				assert.Equal(t, l.expected, time.Since(start))
+
+				err := r.WaitN(t.Context(), 11)
+				assert.ErrorIs(t, err, ErrExceedsBurst)
+				assert.EqualError(t, err, "asked for 11 but burst is 10: exceeds burst")
+
+				for _, n := range []int{0, -100} {
+					err = r.WaitN(t.Context(), n)
+					assert.ErrorIs(t, err, ErrInvalidN)
+				}
+
+				// and nothing was reserved by them
+				err = r.WaitN(t.Context(), 1)
+				assert.NoError(t, err)
+			})
+		})
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"math"
 	"sync"
 	"time"
 )
@@ -13,7 +13,9 @@ type SlidingWindowCounter struct {
 	lastWindow time.Time
 	prevCount  float64
 	curCount   float64
-	mu         *sync.Mutex
+	// counts reserved for windows after lastWindow
+	pending map[time.Time]float64
+	mu      *sync.Mutex
 }
 
 func NewSlidingWindowCounter(limit int, windowSize time.Duration) *SlidingWindowCounter {
@@ -23,42 +25,207 @@ func NewSlidingWindowCounter(limit int, windowSize time.Duration) *SlidingWindow
 		lastWindow: time.Now().Truncate(windowSize),
 		prevCount:  0,
 		curCount:   0,
+		pending:    make(map[time.Time]float64),
 		mu:         &sync.Mutex{},
 	}
 }
 
 func (s *SlidingWindowCounter) Allow(ctx context.Context) bool {
+	return s.AllowN(ctx, 1)
+}
+
+// AllowN reports whether a request costing n would be allowed right now and
+// counts it if so. It is always false when n is less than 1 or more than the
+// limit
+func (s *SlidingWindowCounter) AllowN(ctx context.Context, n int) bool {
+	if n < 1 {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.advance(now)
+
+	if !s.fits(s.countAt(now), float64(n)) {
+		return false
+	}
+
+	s.curCount += float64(n)
+
+	return true
+}
+
+// Reserve counts a request at the earliest time it would be allowed, the
+// reservation says how long that is from now
+func (s *SlidingWindowCounter) Reserve() *Reservation {
+	return s.reserveN(1)
+}
+
+// Wait blocks until a request would be allowed or ctx is done
+func (s *SlidingWindowCounter) Wait(ctx context.Context) error {
+	return s.WaitN(ctx, 1)
+}
+
+// WaitN blocks until a request costing n would be allowed or ctx is done. n
+// has to be at least 1 and can't be more than the limit since no window would
+// ever have room for it
+func (s *SlidingWindowCounter) WaitN(ctx context.Context, n int) error {
+	err := checkN(n, int(s.limit))
+	if err != nil {
+		return err
+	}
+
+	return wait(ctx, s.reserveN(n))
+}
+
+func (s *SlidingWindowCounter) reserveN(n int) *Reservation {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now()
+	s.advance(now)
+
+	at, ok := s.earliest(now, float64(n))
+	if !ok {
+		// no window will ever have room so there is nothing to count
+		return newReservation(now.Add(math.MaxInt64), func() {})
+	}
+
+	window := at.Truncate(s.windowSize)
+
+	s.add(window, float64(n))
+
+	return newReservation(at, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.advance(time.Now())
+		s.add(window, -float64(n))
+	})
+}
+
+// fits reports whether n more can be counted on top of count. Like a single
+// request, the last of the n only has to start out under the limit
+func (s *SlidingWindowCounter) fits(count, n float64) bool {
+	return count+n-1 < s.limit
+}
+
+// advance moves the windows along to the one now is in
+func (s *SlidingWindowCounter) advance(now time.Time) {
 	curWindow := now.Truncate(s.windowSize)
 
-	if curWindow != s.lastWindow {
-		if curWindow.Sub(s.lastWindow) >= 2*s.windowSize {
-			// over 2 window sizes, reset everything
-			s.prevCount = 0
-			s.curCount = 0
-		} else {
-			// we have just moved 1 window
-			s.prevCount = s.curCount
-			s.curCount = 0
-		}
+	if curWindow == s.lastWindow {
+		return
+	}
 
-		s.lastWindow = curWindow
+	if curWindow.Sub(s.lastWindow) >= 2*s.windowSize {
+		// over 2 window sizes, reset everything but what was reserved
+		s.prevCount = s.pending[curWindow.Add(-s.windowSize)]
+	} else {
+		// we have just moved 1 window
+		s.prevCount = s.curCount
 	}
 
-	elapsedTimeInWindow := now.Sub(curWindow)
+	s.curCount = s.pending[curWindow]
+	s.lastWindow = curWindow
+
+	for window := range s.pending {
+		if !window.After(curWindow) {
+			delete(s.pending, window)
+		}
+	}
+}
+
+// countAt is the weighted count at now, which must be in the current window
+func (s *SlidingWindowCounter) countAt(now time.Time) float64 {
+	elapsedTimeInWindow := now.Sub(s.lastWindow)
 	weight := 1 - (float64(elapsedTimeInWindow) / float64(s.windowSize))
-	adjustedCount := (weight * s.prevCount) + s.curCount
 
-	fmt.Println(adjustedCount, s.prevCount, s.curCount, weight)
+	return (weight * s.prevCount) + s.curCount
+}
 
-	if adjustedCount >= s.limit {
-		return false
+// count returns how many requests are counted against the window starting at
+// window, reservations included
+func (s *SlidingWindowCounter) count(window time.Time) float64 {
+	switch {
+	case window.Equal(s.lastWindow):
+		return s.curCount
+	case window.Equal(s.lastWindow.Add(-s.windowSize)):
+		return s.prevCount
+	case window.After(s.lastWindow):
+		return s.pending[window]
+	default:
+		return 0
 	}
+}
 
-	s.curCount++
+func (s *SlidingWindowCounter) add(window time.Time, n float64) {
+	switch {
+	case window.Equal(s.lastWindow):
+		s.curCount += n
+	case window.Equal(s.lastWindow.Add(-s.windowSize)):
+		s.prevCount += n
+	case window.After(s.lastWindow):
+		if s.pending == nil {
+			s.pending = make(map[time.Time]float64)
+		}
 
-	return true
+		s.pending[window] += n
+		if s.pending[window] <= 0 {
+			delete(s.pending, window)
+		}
+	}
+}
+
+// earliest finds the first time from now on that a request costing n would be
+// allowed. ok is false if it never would be, which is the case when n is more
+// than the limit
+func (s *SlidingWindowCounter) earliest(now time.Time, n float64) (at time.Time, ok bool) {
+	if !s.fits(0, n) {
+		return at, false
+	}
+
+	// the window after the last reserved one starts out empty and only has
+	// the reserved one's share to wait out, so it is never full
+	last := s.lastWindow
+	for window := range s.pending {
+		if window.After(last) {
+			last = window
+		}
+	}
+
+	last = last.Add(s.windowSize)
+
+	for window := s.lastWindow; !window.After(last); window = window.Add(s.windowSize) {
+		prev := s.count(window.Add(-s.windowSize))
+		cur := s.count(window)
+
+		if !s.fits(cur, n) {
+			// full no matter how little of prev is left
+			continue
+		}
+
+		// the weighted count has to drop low enough, which happens once
+		// enough of the window has passed to shrink prev's share
+		at := window
+		if prev > 0 {
+			needed := 1 - (s.limit-cur-n+1)/prev
+			if needed >= 0 {
+				// just past the point where it equals the limit
+				at = window.Add(time.Duration(needed*float64(s.windowSize)) + 1)
+			}
+		}
+
+		if at.Before(now) {
+			at = now
+		}
+
+		if at.Before(window.Add(s.windowSize)) {
+			return at, true
+		}
+	}
+
+	return at, false
 }
@@ -2,65 +2,129 @@ package main
 
 import (
 	"context"
-	"log/slog"
+	"math"
 	"sync"
 	"time"
 )
 
+// tokenBucket refills lazily, working out how many tokens have been added
+// since the last call rather than having something add them as time passes
 type tokenBucket struct {
-	done chan any
-
-	tokens      int
-	maxTokens   int
-	refreshRate int
-	mu          sync.Mutex
+	// tokens goes negative when permits are reserved ahead of time
+	tokens     float64
+	maxTokens  float64
+	rate       float64 // tokens per second
+	lastRefill time.Time
+	mu         *sync.Mutex
 }
 
-func New(maxTokens int, refreshRatePerSecond int) *tokenBucket {
+// New returns a bucket holding up to maxTokens that starts full and refills at
+// refreshRatePerSecond, which can be below 1 for rates slower than a token a
+// second
+func New(maxTokens int, refreshRatePerSecond float64) *tokenBucket {
 	return &tokenBucket{
-		done:        make(chan any),
-		tokens:      maxTokens,
-		maxTokens:   maxTokens,
-		refreshRate: refreshRatePerSecond,
-		mu:          sync.Mutex{},
+		tokens:     float64(maxTokens),
+		maxTokens:  float64(maxTokens),
+		rate:       refreshRatePerSecond,
+		lastRefill: time.Now(),
+		mu:         &sync.Mutex{},
 	}
 }
 
-func (t *tokenBucket) Start() *tokenBucket {
-	go func() {
-		for {
-			select {
-			case <-t.done:
-				return
-			case <-time.After(1 * time.Second):
-				t.mu.Lock()
-
-				if t.tokens < t.maxTokens {
-					t.tokens += 1
-					slog.Info("reload")
-				}
-
-				t.mu.Unlock()
-			}
-		}
-	}()
-
-	return t
+func (t *tokenBucket) Allow(ctx context.Context) bool {
+	return t.AllowN(ctx, 1)
 }
 
-func (t *tokenBucket) Stop() {
-	close(t.done)
-}
+// AllowN reports whether n tokens are available right now and takes them if
+// they are. It is always false when n is less than 1 or more than the bucket
+// holds
+func (t *tokenBucket) AllowN(ctx context.Context, n int) bool {
+	if n < 1 {
+		return false
+	}
 
-func (t *tokenBucket) Allow(ctx context.Context) bool {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	if t.tokens == 0 {
+	t.refill(time.Now())
+
+	if t.tokens < float64(n) {
 		return false
 	}
 
-	t.tokens -= 1
+	t.tokens -= float64(n)
 
 	return true
 }
+
+// Reserve takes a token now even if there isn't one, the reservation says how
+// long until the refills catch up with it
+func (t *tokenBucket) Reserve() *Reservation {
+	return t.reserveN(1)
+}
+
+// Wait blocks until a token is available or ctx is done
+func (t *tokenBucket) Wait(ctx context.Context) error {
+	return t.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available or ctx is done. n has to be at
+// least 1 and can't be more than the bucket holds since it would never fill up
+// enough
+func (t *tokenBucket) WaitN(ctx context.Context, n int) error {
+	err := checkN(n, int(t.maxTokens))
+	if err != nil {
+		return err
+	}
+
+	return wait(ctx, t.reserveN(n))
+}
+
+func (t *tokenBucket) reserveN(n int) *Reservation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.refill(now)
+
+	t.tokens -= float64(n)
+
+	at := now
+	if t.tokens < 0 {
+		at = now.Add(t.timeToRefill(-t.tokens))
+	}
+
+	return newReservation(at, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.refill(time.Now())
+		t.tokens = min(t.tokens+float64(n), t.maxTokens)
+	})
+}
+
+// refill adds the tokens earned since the last refill, t.mu must be held
+func (t *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(t.lastRefill)
+	if elapsed <= 0 {
+		return
+	}
+
+	t.tokens = min(t.tokens+elapsed.Seconds()*t.rate, t.maxTokens)
+	t.lastRefill = now
+}
+
+// timeToRefill is how long it takes to earn n tokens
+func (t *tokenBucket) timeToRefill(n float64) time.Duration {
+	if t.rate <= 0 {
+		// never refills so it is never going to happen
+		return math.MaxInt64
+	}
+
+	seconds := n / t.rate
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return math.MaxInt64
+	}
+
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		limiter     *tokenBucket
+		timeElapsed time.Duration
+		expected    bool
+	}{
+		{
+			desc: "allows when there are tokens",
+			limiter: &tokenBucket{
+				tokens:    1,
+				maxTokens: 5,
+				rate:      1,
+				mu:        &sync.Mutex{},
+			},
+			expected: true,
+		},
+		{
+			desc: "rejects when empty",
+			limiter: &tokenBucket{
+				tokens:    0,
+				maxTokens: 5,
+				rate:      1,
+				mu:        &sync.Mutex{},
+			},
+			timeElapsed: 999 * time.Millisecond,
+			expected:    false,
+		},
+		{
+			desc: "refills from elapsed time",
+			limiter: &tokenBucket{
+				tokens:    0,
+				maxTokens: 5,
+				rate:      1,
+				mu:        &sync.Mutex{},
+			},
+			timeElapsed: time.Second,
+			expected:    true,
+		},
+		{
+			desc: "fractional tokens add up",
+			limiter: &tokenBucket{
+				tokens:    0.5,
+				maxTokens: 5,
+				rate:      10,
+				mu:        &sync.Mutex{},
+			},
+			timeElapsed: 50 * time.Millisecond, // 0.5 more
+			expected:    true,
+		},
+		{
+			desc: "sub-second rate",
+			limiter: &tokenBucket{
+				tokens:    0,
+				maxTokens: 5,
+				rate:      0.5,
+				mu:        &sync.Mutex{},
+			},
+			timeElapsed: 1 * time.Second, // half a token
+			expected:    false,
+		},
+		{
+			desc: "paying back a reservation",
+			limiter: &tokenBucket{
+				tokens:    -2,
+				maxTokens: 5,
+				rate:      1,
+				mu:        &sync.Mutex{},
+			},
+			timeElapsed: 2 * time.Second, // back to 0
+			expected:    false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				tc.limiter.lastRefill = time.Now()
+
+				time.Sleep(tc.timeElapsed)
+
+				actual := tc.limiter.Allow(t.Context())
+
+				assert.Equal(t, tc.expected, actual)
+			})
+		})
+	}
+}
+
+func TestTokenBucketRefillCapped(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := New(3, 1)
+
+		// idle for ages but only ever holds 3
+		time.Sleep(time.Hour)
+
+		allowed := 0
+		for b.Allow(t.Context()) {
+			allowed++
+		}
+
+		assert.Equal(t, 3, allowed)
+
+		// and comes back at the configured rate
+		time.Sleep(2 * time.Second)
+
+		assert.True(t, b.Allow(t.Context()))
+		assert.True(t, b.Allow(t.Context()))
+		assert.False(t, b.Allow(t.Context()))
+	})
+}
+
+func TestTokenBucketReserveSubSecondRate(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		b := New(1, 0.25)
+
+		assert.Equal(t, time.Duration(0), b.Reserve().Delay())
+		assert.Equal(t, 4*time.Second, b.Reserve().Delay())
+		assert.Equal(t, 8*time.Second, b.Reserve().Delay())
+	})
+}
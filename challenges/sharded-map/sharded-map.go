@@ -0,0 +1,146 @@
+// Package shardedmap is a concurrent map split into shards, each with its own
+// lock, so goroutines working on different keys rarely wait on each other
+package shardedmap
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+type ShardedMap[V any] struct {
+	shards     []map[string]V
+	locks      []*sync.RWMutex
+	totalCount *atomic.Int32
+}
+
+func NewShardedMap[V any](numShards int) *ShardedMap[V] {
+	numShards = max(numShards, 1)
+
+	shards := make([]map[string]V, 0, numShards)
+	locks := make([]*sync.RWMutex, 0, numShards)
+
+	for range numShards {
+		shards = append(shards, make(map[string]V))
+		locks = append(locks, &sync.RWMutex{})
+	}
+
+	return &ShardedMap[V]{
+		shards:     shards,
+		locks:      locks,
+		totalCount: &atomic.Int32{},
+	}
+}
+
+func (m *ShardedMap[V]) Get(key string) (V, bool) {
+	n := shard(key, len(m.shards))
+
+	s := m.shards[n]
+	l := m.locks[n]
+
+	l.RLock()
+	defer l.RUnlock()
+
+	val, found := s[key]
+
+	return val, found
+}
+
+func (m *ShardedMap[V]) Put(key string, value V) {
+	n := shard(key, len(m.shards))
+
+	s := m.shards[n]
+	l := m.locks[n]
+
+	l.Lock()
+	defer l.Unlock()
+
+	_, found := s[key]
+	if !found {
+		m.totalCount.Add(1)
+	}
+
+	s[key] = value
+}
+
+// GetOrCreate returns the value for key, calling create and storing what it
+// returns if there isn't one. create is called with the shard locked so it
+// only ever runs once per key, loaded is true if it didn't run
+func (m *ShardedMap[V]) GetOrCreate(key string, create func() V) (value V, loaded bool) {
+	value, found := m.Get(key)
+	if found {
+		return value, true
+	}
+
+	n := shard(key, len(m.shards))
+
+	s := m.shards[n]
+	l := m.locks[n]
+
+	l.Lock()
+	defer l.Unlock()
+
+	// someone else may have created it between the locks
+	value, found = s[key]
+	if found {
+		return value, true
+	}
+
+	value = create()
+	s[key] = value
+	m.totalCount.Add(1)
+
+	return value, false
+}
+
+func (m *ShardedMap[V]) Delete(key string) {
+	n := shard(key, len(m.shards))
+
+	s := m.shards[n]
+	l := m.locks[n]
+
+	l.Lock()
+	defer l.Unlock()
+
+	_, found := s[key]
+	if found {
+		delete(s, key)
+		m.totalCount.Add(-1)
+	}
+}
+
+// DeleteFunc deletes every entry fn returns true for and returns how many it
+// deleted. Each shard is locked while fn is called on its entries
+func (m *ShardedMap[V]) DeleteFunc(fn func(key string, value V) bool) int {
+	deleted := 0
+
+	for n, s := range m.shards {
+		l := m.locks[n]
+
+		l.Lock()
+
+		for key, value := range s {
+			if fn(key, value) {
+				delete(s, key)
+				m.totalCount.Add(-1)
+				deleted++
+			}
+		}
+
+		l.Unlock()
+	}
+
+	return deleted
+}
+
+func (m *ShardedMap[V]) Len() int {
+	return int(m.totalCount.Load())
+}
+
+func shard(key string, numShards int) int {
+	h := fnv.New32()
+	h.Write([]byte(key))
+	v := h.Sum32()
+
+	return int(v % uint32(numShards))
+}
@@ -0,0 +1,76 @@
+package shardedmap
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedMap(t *testing.T) {
+	m := NewShardedMap[int](4)
+
+	m.Put("a", 1)
+	m.Put("b", 2)
+	m.Put("a", 3)
+
+	val, found := m.Get("a")
+	assert.True(t, found)
+	assert.Equal(t, 3, val)
+	assert.Equal(t, 2, m.Len())
+
+	m.Delete("a")
+	m.Delete("missing")
+
+	_, found = m.Get("a")
+	assert.False(t, found)
+	assert.Equal(t, 1, m.Len())
+}
+
+func TestShardedMap_GetOrCreate(t *testing.T) {
+	m := NewShardedMap[int](4)
+
+	var created atomic.Int32
+	var wg sync.WaitGroup
+
+	for range 100 {
+		wg.Go(func() {
+			val, _ := m.GetOrCreate("a", func() int {
+				return int(created.Add(1))
+			})
+
+			assert.Equal(t, 1, val)
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created.Load())
+	assert.Equal(t, 1, m.Len())
+
+	val, loaded := m.GetOrCreate("a", func() int { return 2 })
+	assert.True(t, loaded)
+	assert.Equal(t, 1, val)
+}
+
+func TestShardedMap_DeleteFunc(t *testing.T) {
+	m := NewShardedMap[int](4)
+
+	for i := range 10 {
+		m.Put(fmt.Sprintf("key_%d", i), i)
+	}
+
+	deleted := m.DeleteFunc(func(key string, value int) bool {
+		return value%2 == 0
+	})
+
+	assert.Equal(t, 5, deleted)
+	assert.Equal(t, 5, m.Len())
+
+	for i := range 10 {
+		_, ok := m.Get(fmt.Sprintf("key_%d", i))
+		assert.Equal(t, i%2 != 0, ok)
+	}
+}
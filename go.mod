@@ -2,10 +2,7 @@ module github.com/goconc
 
 go 1.25.4
 
-require (
-	github.com/stretchr/testify v1.10.0
-	golang.org/x/sync v0.16.0
-)
+require github.com/stretchr/testify v1.10.0
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect